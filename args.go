@@ -0,0 +1,179 @@
+package cpanelgo
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Numbered holds the values of an argument which are sent as name-1, name-2, ...
+// instead of by repeating name, for the functions which expect them that way.
+type Numbered []string
+
+// JSONArg is an argument sent as JSON, for functions taking structured values.
+type JSONArg struct {
+	Value interface{}
+}
+
+// JSON wraps v to be sent as JSON.
+func JSON(v interface{}) JSONArg {
+	return JSONArg{Value: v}
+}
+
+// Param is an argument as it is sent to the API.
+type Param struct {
+	Name  string
+	Value string
+}
+
+// Params are the arguments of a call, encoded and in the order they are sent.
+type Params []Param
+
+// EncodeArgs encodes the arguments of a call in a stable order: the named arguments
+// sorted by name, the values of multi-valued ones in the order given, then the
+// positional ones of API 1 as arg-0, arg-1, ... The gateways send the parameters in
+// that order, see Params.Encode. Args is a map, so the order in which named arguments
+// were written is not kept, and there is deliberately no ordered form of them: cPanel
+// and WHM look them up by name, and only the positional arguments of API 1 and the
+// values of a multi-valued argument depend on their order. Values are encoded the way
+// cPanel expects them:
+//
+//   - bool as 1 or 0
+//   - time.Time as a Unix timestamp
+//   - encoding.TextMarshaler and fmt.Stringer, e.g. net.IP, as their text
+//   - []byte and other byte slices as a string
+//   - slices and arrays by repeating the name, Numbered as name-1, name-2, ...
+//   - JSONArg, maps and structs as JSON
+//   - nil as an empty string, pointers as what they point to
+//   - anything else formatted with %v
+//
+// It fails with the first argument which cannot be encoded, and the gateways do not
+// send a call whose arguments failed. The parameters are still returned, with that
+// argument formatted with %v.
+func EncodeArgs(args Args, positional []string) (Params, error) {
+	names := make([]string, 0, len(args))
+	for name := range args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var p Params
+	var err error
+	for _, name := range names {
+		var argErr error
+		p, argErr = p.add(name, args[name])
+		if argErr != nil && err == nil {
+			err = fmt.Errorf("argument %s: %w", name, argErr)
+		}
+	}
+	for i, v := range positional {
+		p = append(p, Param{Name: "arg-" + strconv.Itoa(i), Value: v})
+	}
+	return p, err
+}
+
+// add appends the encoding of v under name
+func (p Params) add(name string, v interface{}) (Params, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(p, Param{name, ""}), nil
+	case string:
+		return append(p, Param{name, v}), nil
+	case bool:
+		if v {
+			return append(p, Param{name, "1"}), nil
+		}
+		return append(p, Param{name, "0"}), nil
+	case float64:
+		return append(p, Param{name, strconv.FormatFloat(v, 'f', -1, 64)}), nil
+	case float32:
+		return append(p, Param{name, strconv.FormatFloat(float64(v), 'f', -1, 32)}), nil
+	case time.Time:
+		return append(p, Param{name, strconv.FormatInt(v.Unix(), 10)}), nil
+	case Numbered:
+		for i, s := range v {
+			p = append(p, Param{name + "-" + strconv.Itoa(i+1), s})
+		}
+		return p, nil
+	case []byte:
+		return append(p, Param{name, string(v)}), nil
+	case JSONArg:
+		return p.addJSON(name, v.Value)
+	case json.RawMessage:
+		return append(p, Param{name, string(v)}), nil
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return append(p, Param{name, ""}), nil
+	}
+
+	switch v := v.(type) {
+	case encoding.TextMarshaler:
+		text, err := v.MarshalText()
+		if err != nil {
+			return append(p, Param{name, fmt.Sprintf("%v", v)}), err
+		}
+		return append(p, Param{name, string(text)}), nil
+	case fmt.Stringer:
+		return append(p, Param{name, v.String()}), nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Ptr:
+		return p.add(name, rv.Elem().Interface())
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8 {
+			return append(p, Param{name, string(rv.Bytes())}), nil
+		}
+		var err error
+		for i := 0; i < rv.Len(); i++ {
+			var elemErr error
+			p, elemErr = p.add(name, rv.Index(i).Interface())
+			if elemErr != nil && err == nil {
+				err = elemErr
+			}
+		}
+		return p, err
+	case reflect.Map, reflect.Struct:
+		return p.addJSON(name, v)
+	}
+	return append(p, Param{name, fmt.Sprintf("%v", v)}), nil
+}
+
+func (p Params) addJSON(name string, v interface{}) (Params, error) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return append(p, Param{name, fmt.Sprintf("%v", v)}), err
+	}
+	return append(p, Param{name, string(buf)}), nil
+}
+
+// Values returns the parameters as url.Values.
+func (p Params) Values() url.Values {
+	vals := url.Values{}
+	for _, param := range p {
+		vals.Add(param.Name, param.Value)
+	}
+	return vals
+}
+
+// Encode returns the parameters URL encoded, in their order.
+func (p Params) Encode() string {
+	var sb strings.Builder
+	for i, param := range p {
+		if i > 0 {
+			sb.WriteByte('&')
+		}
+		sb.WriteString(url.QueryEscape(param.Name))
+		sb.WriteByte('=')
+		sb.WriteString(url.QueryEscape(param.Value))
+	}
+	return sb.String()
+}
@@ -0,0 +1,99 @@
+package cpanelgo
+
+import (
+	"net"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEncodeArgs(t *testing.T) {
+	type record struct {
+		Name string `json:"name"`
+	}
+	var nilPtr *int
+	count := 3
+
+	params, err := EncodeArgs(Args{
+		"enabled":  true,
+		"disabled": false,
+		"domain":   []string{"b.example.com", "a.example.com"},
+		"line":     Numbered{"10", "12"},
+		"expires":  time.Unix(1600000000, 0),
+		"ratio":    0.5,
+		"big":      1e21,
+		"count":    &count,
+		"none":     nilPtr,
+		"record":   record{Name: "www"},
+		"records":  JSON([]record{{Name: "@"}}),
+		"ports":    [2]int{80, 443},
+		"ip":       net.ParseIP("192.0.2.1"),
+		"ips":      []net.IP{net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8::1")},
+		"raw":      []byte("bytes"),
+		"ttl":      5 * time.Minute,
+	}, []string{"stdheader.html", "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Params{
+		{"big", "1000000000000000000000"},
+		{"count", "3"},
+		{"disabled", "0"},
+		{"domain", "b.example.com"},
+		{"domain", "a.example.com"},
+		{"enabled", "1"},
+		{"expires", "1600000000"},
+		{"ip", "192.0.2.1"},
+		{"ips", "192.0.2.1"},
+		{"ips", "2001:db8::1"},
+		{"line-1", "10"},
+		{"line-2", "12"},
+		{"none", ""},
+		{"ports", "80"},
+		{"ports", "443"},
+		{"ratio", "0.5"},
+		{"raw", "bytes"},
+		{"record", `{"name":"www"}`},
+		{"records", `[{"name":"@"}]`},
+		{"ttl", "5m0s"},
+		{"arg-0", "stdheader.html"},
+		{"arg-1", "1"},
+	}
+	if !reflect.DeepEqual(params, expected) {
+		t.Errorf("unexpected parameters:\n%+v\nexpected:\n%+v", params, expected)
+	}
+
+	vals := params.Values()
+	if !reflect.DeepEqual(vals["domain"], []string{"b.example.com", "a.example.com"}) || vals.Get("arg-1") != "1" {
+		t.Errorf("unexpected values: %v", vals)
+	}
+	if q := (Params{{"b", "1"}, {"a", "x y"}}).Encode(); q != "b=1&a=x+y" {
+		t.Errorf("unexpected order: %s", q)
+	}
+
+	params, err = EncodeArgs(Args{"bad": JSON(make(chan int))}, nil)
+	if err == nil || len(params) != 1 {
+		t.Errorf("expected an error for an argument not encodable as JSON, got: %+v, %v", params, err)
+	}
+}
+
+func TestArgs_ValuesTyped(t *testing.T) {
+	actual := Args{"enabled": true, "domain": []string{"a", "b"}}.Values("uapi")
+	expected := url.Values{"enabled": {"1"}, "domain": {"a", "b"}}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Unexpected Args.Values(), expected: '%+v', got: '%+v'", expected, actual)
+	}
+}
+
+func TestArgs_Params(t *testing.T) {
+	if _, err := (Args{"bad": JSON(make(chan int))}).Params("uapi"); err == nil {
+		t.Error("expected an error for an argument not encodable as JSON")
+	}
+	params, err := Args{"b=2": nil, "a=1": nil, "c": nil}.Params("1")
+	expected := Params{{"a", "1"}, {"b", "2"}, {"c", ""}}
+	if err != nil || !reflect.DeepEqual(params, expected) {
+		t.Errorf("expected %+v, got: %+v, %v", expected, params, err)
+	}
+}
@@ -0,0 +1,68 @@
+package cpanelgo
+
+import "errors"
+
+// ErrBatchNotRun is the error of a call in a batch which was not run, because an
+// earlier call of the batch failed and the batch stops at the first failure.
+var ErrBatchNotRun = errors.New("not run: an earlier call in the batch failed")
+
+// BatchCall is a call queued in a batch. Once the batch was sent, its response is
+// decoded into the value it was queued with, and Err reports its own failure.
+type BatchCall struct {
+	Module   string // empty for WHM API 1
+	Function string
+	Args     Args
+	out      interface{}
+	err      error
+	done     bool
+}
+
+// NewBatchCall queues a call of function whose response is decoded into out.
+func NewBatchCall(module, function string, args Args, out interface{}) *BatchCall {
+	return &BatchCall{
+		Module:   module,
+		Function: function,
+		Args:     args,
+		out:      out,
+	}
+}
+
+// Out returns what the response of the call is decoded into.
+func (c *BatchCall) Out() interface{} {
+	return c.out
+}
+
+// Finish records the outcome of the call once its batch was sent.
+func (c *BatchCall) Finish(err error) {
+	c.done = true
+	c.err = err
+}
+
+// Done reports whether the batch of the call was sent.
+func (c *BatchCall) Done() bool {
+	return c.done
+}
+
+// Err returns why the call failed, nil if it succeeded or was not sent yet.
+func (c *BatchCall) Err() error {
+	return c.err
+}
+
+// FirstError returns the first error among calls.
+func FirstError(calls []*BatchCall) error {
+	for _, c := range calls {
+		if c.err != nil {
+			return c.err
+		}
+	}
+	return nil
+}
+
+// ResponseError returns the failure reported by out, if it is a response with an
+// Error method such as the types embedding BaseUAPIResponse.
+func ResponseError(out interface{}) error {
+	if r, ok := out.(interface{ Error() error }); ok {
+		return r.Error()
+	}
+	return nil
+}
@@ -1,15 +1,11 @@
 package cpanel
 
 import (
-	"crypto/tls"
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"io"
-	"io/ioutil"
-	"log"
 	"net/http"
-	"os"
+	"strings"
 
 	"github.com/letsencrypt-cpanel/cpanelgo"
 )
@@ -18,8 +14,24 @@ type JsonApiGateway struct {
 	Hostname string
 	Username string
 	Password string
+	// cPanel API token, used instead of the password when set
+	Token string
+	// When set, log in once and reuse the session instead of authenticating every call
+	Session  *cpanelgo.Session
 	Insecure bool
-	cl       *http.Client
+	// When set, used instead of https://Hostname:2083. Hostname is its default Host.
+	Endpoint *cpanelgo.Endpoint
+	// Maximum size of a response in bytes, defaults to cpanelgo.ResponseSizeLimit
+	ResponseSizeLimit int64
+	// Decides between GET and POST, defaults to cpanelgo.DefaultMethodPolicy
+	MethodPolicy *cpanelgo.MethodPolicy
+	// Run around every call made through the gateway
+	Interceptors cpanelgo.Interceptors
+	// Defaults to cpanelgo.DefaultLogger()
+	Logger cpanelgo.Logger
+	// Limits the requests to the server, defaults to cpanelgo.ServerLimiter of its host
+	Limiter *cpanelgo.Limiter
+	cl      *http.Client
 }
 
 func NewJsonApi(hostname, username, password string, insecure bool) (CpanelApi, error) {
@@ -47,126 +59,237 @@ func NewJsonApiWithClient(hostname, username, password string, insecure bool, cl
 	return CpanelApi{cpanelgo.NewApi(c)}, nil
 }
 
-func (c *JsonApiGateway) UAPI(module, function string, arguments cpanelgo.Args, out interface{}) error {
-	req := CpanelApiRequest{
-		ApiVersion: "uapi",
-		Module:     module,
-		Function:   function,
-		Arguments:  arguments,
+func NewJsonApiToken(hostname, username, token string, insecure bool) (CpanelApi, error) {
+	c := &JsonApiGateway{
+		Hostname: hostname,
+		Username: username,
+		Token:    strings.TrimSpace(token),
+		Insecure: insecure,
 	}
 
-	return c.api(req, out)
+	return CpanelApi{cpanelgo.NewApi(c)}, nil
 }
 
-func (c *JsonApiGateway) API2(module, function string, arguments cpanelgo.Args, out interface{}) error {
-	req := CpanelApiRequest{
-		ApiVersion: "2",
-		Module:     module,
-		Function:   function,
-		Arguments:  arguments,
+func NewJsonApiTokenWithClient(hostname, username, token string, insecure bool, cl *http.Client) (CpanelApi, error) {
+	c := &JsonApiGateway{
+		Hostname: hostname,
+		Username: username,
+		Token:    strings.TrimSpace(token),
+		Insecure: insecure,
+		cl:       cl,
 	}
 
-	var result cpanelgo.API2Result
-	err := c.api(req, &result)
-	if err == nil {
-		err = result.Error()
-	}
-	if err != nil {
-		return err
+	return CpanelApi{cpanelgo.NewApi(c)}, nil
+}
+
+// NewJsonApiSession logs in once and reuses the session for all calls, which avoids
+// tripping cPHulk on busy servers. totpSecret is only needed for accounts with
+// two-factor authentication.
+func NewJsonApiSession(hostname, username, password, totpSecret string, insecure bool) (CpanelApi, error) {
+	c := &JsonApiGateway{
+		Hostname: hostname,
+		Username: username,
+		Session:  cpanelgo.NewSession(username, password, totpSecret),
+		Insecure: insecure,
 	}
 
-	return json.Unmarshal(result.Result, out)
+	return CpanelApi{cpanelgo.NewApi(c)}, nil
 }
 
-func (c *JsonApiGateway) API1(module, function string, arguments []string, out interface{}) error {
-	args := cpanelgo.Args{}
-	for _, v := range arguments {
-		args[v] = true
-	}
+func (c *JsonApiGateway) UAPI(module, function string, arguments cpanelgo.Args, out interface{}) error {
+	return c.UAPIContext(context.Background(), module, function, arguments, out)
+}
 
-	req := CpanelApiRequest{
-		ApiVersion: "1",
+func (c *JsonApiGateway) UAPIContext(ctx context.Context, module, function string, arguments cpanelgo.Args, out interface{}) error {
+	return c.Interceptors.Invoke(ctx, &cpanelgo.Call{
+		APIVersion: "uapi",
 		Module:     module,
 		Function:   function,
-		Arguments:  args,
-	}
+		Args:       arguments,
+	}, out, c.invoke)
+}
 
-	return c.api(req, out)
+func (c *JsonApiGateway) API2(module, function string, arguments cpanelgo.Args, out interface{}) error {
+	return c.API2Context(context.Background(), module, function, arguments, out)
+}
+
+func (c *JsonApiGateway) API2Context(ctx context.Context, module, function string, arguments cpanelgo.Args, out interface{}) error {
+	return c.Interceptors.Invoke(ctx, &cpanelgo.Call{
+		APIVersion: "2",
+		Module:     module,
+		Function:   function,
+		Args:       arguments,
+	}, out, c.invoke)
+}
+
+func (c *JsonApiGateway) API1(module, function string, arguments []string, out interface{}) error {
+	return c.API1Context(context.Background(), module, function, arguments, out)
+}
+
+func (c *JsonApiGateway) API1Context(ctx context.Context, module, function string, arguments []string, out interface{}) error {
+	return c.Interceptors.Invoke(ctx, &cpanelgo.Call{
+		APIVersion:     "1",
+		Module:         module,
+		Function:       function,
+		PositionalArgs: arguments,
+	}, out, c.invoke)
 }
 
 func (c *JsonApiGateway) Close() error {
 	return nil
 }
 
-func (c *JsonApiGateway) api(req CpanelApiRequest, out interface{}) error {
-	vals := req.Arguments.Values(req.ApiVersion)
-	reqUrl := fmt.Sprintf("https://%s:2083/", c.Hostname)
-	switch req.ApiVersion {
-	case "uapi":
-		// https://hostname.example.com:2083/cpsess##########/execute/Module/function?parameter=value&parameter=value&parameter=value
-		reqUrl += fmt.Sprintf("execute/%s/%s?%s", req.Module, req.Function, vals.Encode())
+// invoke performs the call once it has passed through the interceptors
+func (c *JsonApiGateway) invoke(ctx context.Context, call *cpanelgo.Call, out interface{}) error {
+	req := CpanelApiRequest{
+		ApiVersion: call.APIVersion,
+		Module:     call.Module,
+		Function:   call.Function,
+		Arguments:  call.Args,
+	}
+
+	switch call.APIVersion {
 	case "2":
-		fallthrough
-	case "1":
-		// https://hostname.example.com:2083/cpsess##########/json-api/cpanel?cpanel_jsonapi_user=user&cpanel_jsonapi_apiversion=2&cpanel_jsonapi_module=Module&cpanel_jsonapi_func=function&parameter="value"
-		vals.Add("cpanel_jsonapi_user", c.Username)
-		vals.Add("cpanel_jsonapi_apiversion", req.ApiVersion)
-		vals.Add("cpanel_jsonapi_module", req.Module)
-		vals.Add("cpanel_jsonapi_func", req.Function)
-		reqUrl += fmt.Sprintf("json-api/cpanel?%s", vals.Encode())
-	default:
-		return fmt.Errorf("Unknown api version: %s", req.ApiVersion)
+		var result cpanelgo.API2Result
+		err := c.api(ctx, call, req, &result)
+		if err == nil {
+			err = result.Error()
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := json.Unmarshal(result.Result, out); err != nil {
+			return err
+		}
+		cpanelgo.SetResponseInfo(out, cpanelgo.ResponseInfo{
+			APIVersion: req.ApiVersion,
+			Module:     req.Module,
+			Function:   req.Function,
+			StatusCode: http.StatusOK,
+			Body:       result.Result,
+		})
+		return nil
 	}
 
-	httpReq, err := http.NewRequest("GET", reqUrl, nil)
-	if err != nil {
-		return err
+	return c.api(ctx, call, req, out)
+}
+
+func (c *JsonApiGateway) endpoint() cpanelgo.Endpoint {
+	if c.Endpoint == nil {
+		return cpanelgo.Endpoint{Host: c.Hostname, Port: cpanelgo.CpanelPort}
+	}
+	e := *c.Endpoint
+	if e.Host == "" {
+		e.Host = c.Hostname
 	}
+	return e
+}
 
-	httpReq.SetBasicAuth(c.Username, c.Password)
+// WithEndpoint returns a copy of the gateway which connects to endpoint instead of
+// https://Hostname:2083
+func (c *JsonApiGateway) WithEndpoint(endpoint cpanelgo.Endpoint) *JsonApiGateway {
+	cp := *c
+	cp.Endpoint = &endpoint
+	return &cp
+}
 
-	if c.cl == nil {
-		c.cl = &http.Client{}
-		c.cl.Transport = &http.Transport{
-			DisableKeepAlives:   true,
-			MaxIdleConns:        1,
-			MaxIdleConnsPerHost: 1,
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: c.Insecure,
-			},
-		}
+// WithLimiter returns a copy of the gateway whose requests are limited by l instead
+// of the limiter of its server
+func (c *JsonApiGateway) WithLimiter(l *cpanelgo.Limiter) *JsonApiGateway {
+	cp := *c
+	cp.Limiter = l
+	return &cp
+}
+
+func (c *JsonApiGateway) methodPolicy() cpanelgo.MethodPolicy {
+	if c.MethodPolicy == nil {
+		return cpanelgo.DefaultMethodPolicy
+	}
+	return *c.MethodPolicy
+}
+
+func (c *JsonApiGateway) logger() cpanelgo.Logger {
+	if c.Logger == nil {
+		return cpanelgo.DefaultLogger()
 	}
+	return c.Logger
+}
 
-	resp, err := c.cl.Do(httpReq)
-	if err != nil {
-		return err
+// client returns the client given at construction, or else the shared pooled client.
+// It never modifies c, so copies and concurrent callers all use the same connections.
+func (c *JsonApiGateway) client() *http.Client {
+	if c.cl != nil {
+		return c.cl
 	}
-	defer resp.Body.Close()
+	return cpanelgo.SharedHTTPClient(c.Insecure)
+}
 
-	if resp.StatusCode >= 300 {
-		return errors.New(resp.Status)
+func (c *JsonApiGateway) limiter() *cpanelgo.Limiter {
+	if c.Limiter != nil {
+		return c.Limiter
 	}
+	return cpanelgo.ServerLimiter(c.endpoint().Host)
+}
 
-	// limit maximum response size
-	lReader := io.LimitReader(resp.Body, int64(cpanelgo.ResponseSizeLimit))
+// requester sends the requests of the gateway, authenticated with the session, the
+// API token or the password
+func (c *JsonApiGateway) requester() cpanelgo.Requester {
+	return cpanelgo.Requester{
+		Client:  c.client(),
+		Base:    c.endpoint().URL(),
+		Limiter: c.limiter(),
+		Session: c.Session,
+		Authenticate: func(req *http.Request) error {
+			if c.Token != "" {
+				req.Header.Set("Authorization", fmt.Sprintf("cpanel %s:%s", c.Username, c.Token))
+			} else {
+				req.SetBasicAuth(c.Username, c.Password)
+			}
+			return nil
+		},
+		TokenAuth:         c.Token != "",
+		Name:              "cPanel API",
+		Logger:            c.logger(),
+		ResponseSizeLimit: c.ResponseSizeLimit,
+	}
+}
 
-	bytes, err := ioutil.ReadAll(lReader)
+func (c *JsonApiGateway) api(ctx context.Context, call *cpanelgo.Call, req CpanelApiRequest, out interface{}) error {
+	params, err := cpanelgo.EncodeArgs(req.Arguments, call.PositionalArgs)
 	if err != nil {
 		return err
 	}
-
-	if os.Getenv("DEBUG_CPANEL_RESPONSES") == "1" {
-		log.Println(reqUrl)
-		log.Println(resp.Status)
-		log.Println(req.Function)
-		log.Println(req.Arguments)
-		log.Println(vals)
-		log.Println(string(bytes))
+	var path string
+	switch req.ApiVersion {
+	case "uapi":
+		// https://hostname.example.com:2083/cpsess##########/execute/Module/function?parameter=value&parameter=value&parameter=value
+		path = fmt.Sprintf("execute/%s/%s", req.Module, req.Function)
+	case "2":
+		fallthrough
+	case "1":
+		// https://hostname.example.com:2083/cpsess##########/json-api/cpanel?cpanel_jsonapi_user=user&cpanel_jsonapi_apiversion=2&cpanel_jsonapi_module=Module&cpanel_jsonapi_func=function&parameter="value"
+		params = append(cpanelgo.Params{
+			{Name: "cpanel_jsonapi_user", Value: c.Username},
+			{Name: "cpanel_jsonapi_apiversion", Value: req.ApiVersion},
+			{Name: "cpanel_jsonapi_module", Value: req.Module},
+			{Name: "cpanel_jsonapi_func", Value: req.Function},
+		}, params...)
+		path = "json-api/cpanel"
+	default:
+		return fmt.Errorf("Unknown api version: %s", req.ApiVersion)
 	}
 
-	if len(bytes) == cpanelgo.ResponseSizeLimit {
-		return errors.New("API response maximum size exceeded")
+	info := cpanelgo.ResponseInfo{
+		APIVersion: req.ApiVersion,
+		Module:     req.Module,
+		Function:   req.Function,
 	}
-
-	return json.Unmarshal(bytes, out)
+	method := c.methodPolicy().Method(req.Module, req.Function, params)
+	info, err = c.requester().Call(ctx, call, info, method, path, params, out)
+	if err != nil {
+		return err
+	}
+	cpanelgo.SetResponseInfo(out, info)
+	return nil
 }
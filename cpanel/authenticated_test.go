@@ -0,0 +1,204 @@
+package cpanel_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt-cpanel/cpanelgo"
+	"github.com/letsencrypt-cpanel/cpanelgo/cpanel"
+	"github.com/letsencrypt-cpanel/cpanelgo/cpaneltest"
+)
+
+func TestJsonApiToken(t *testing.T) {
+	tests := []struct {
+		status   int
+		body     string
+		expected error
+	}{
+		{http.StatusOK, `{"status":1,"data":"paper_lantern"}`, nil},
+		{http.StatusUnauthorized, `The API token has expired.`, cpanelgo.ErrTokenExpired},
+		{http.StatusForbidden, `Access denied`, cpanelgo.ErrTokenRejected},
+	}
+
+	for _, test := range tests {
+		var auth string
+		cl := &http.Client{Transport: cpaneltest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+			auth = req.Header.Get("Authorization")
+			return cpaneltest.HTTPResponse(test.status, test.body), nil
+		})}
+
+		api, _ := cpanel.NewJsonApiTokenWithClient("example.com", "bob", "TOKEN\n", false, cl)
+		_, err := api.GetTheme()
+		if auth != "cpanel bob:TOKEN" {
+			t.Errorf("unexpected Authorization header: %q", auth)
+		}
+		if test.expected == nil && err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if test.expected != nil && !errors.Is(err, test.expected) {
+			t.Errorf("expected %v, got: %v", test.expected, err)
+		}
+	}
+}
+
+func TestJsonApiSession(t *testing.T) {
+	logins := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login/", func(w http.ResponseWriter, r *http.Request) {
+		logins++
+		http.SetCookie(w, &http.Cookie{Name: "cpsession", Value: "session" + strconv.Itoa(logins)})
+		fmt.Fprintf(w, `{"status":1,"security_token":"/cpsess%d"}`, logins)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		// only the second session is accepted
+		c, err := r.Cookie("cpsession")
+		if r.URL.Path != "/cpsess2/execute/Themes/get_theme_base" || err != nil || c.Value != "session2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"status":1,"data":"paper_lantern"}`))
+	})
+	cl := &http.Client{Transport: cpaneltest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec.Result(), nil
+	})}
+
+	api, _ := cpanel.NewJsonApiWithClient("example.com", "bob", "", false, cl)
+	api.Gateway.(*cpanel.JsonApiGateway).Session = cpanelgo.NewSession("bob", "hunter2", "")
+
+	for i := 0; i < 2; i++ {
+		theme, err := api.GetTheme()
+		if err != nil || theme.Theme != "paper_lantern" {
+			t.Fatalf("unexpected result: %+v, %v", theme, err)
+		}
+	}
+	if logins != 2 {
+		t.Errorf("expected to log in twice, logged in %d times", logins)
+	}
+}
+
+func TestJsonApiEndpoint(t *testing.T) {
+	var url string
+	cl := &http.Client{Transport: cpaneltest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		url = req.URL.Scheme + "://" + req.URL.Host + req.URL.Path
+		return cpaneltest.HTTPResponse(http.StatusOK, `{"status":1,"data":"paper_lantern"}`), nil
+	})}
+
+	api, _ := cpanel.NewJsonApiWithClient("example.com", "bob", "hunter2", false, cl)
+	gw := api.Gateway.(*cpanel.JsonApiGateway)
+	tests := []struct {
+		gw       *cpanel.JsonApiGateway
+		expected string
+	}{
+		{gw, "https://example.com:2083/execute/Themes/get_theme_base"},
+		{gw.WithEndpoint(cpanelgo.Endpoint{Host: "cpanel.example.com", PathPrefix: "/proxy"}), "https://cpanel.example.com/proxy/execute/Themes/get_theme_base"},
+		{gw.WithEndpoint(cpanelgo.Endpoint{Scheme: "http", Port: 2082}), "http://example.com:2082/execute/Themes/get_theme_base"},
+	}
+	for _, test := range tests {
+		if _, err := (cpanel.CpanelApi{Api: cpanelgo.NewApi(test.gw)}).GetTheme(); err != nil || url != test.expected {
+			t.Errorf("expected a request to %s, got %s: %v", test.expected, url, err)
+		}
+	}
+	if gw.Endpoint != nil {
+		t.Error("WithEndpoint modified the gateway")
+	}
+}
+
+func TestJsonApiLimiter(t *testing.T) {
+	requests := 0
+	cl := &http.Client{Transport: cpaneltest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requests++
+		return cpaneltest.HTTPResponse(http.StatusOK, `{"status":1,"data":"paper_lantern"}`), nil
+	})}
+
+	api, _ := cpanel.NewJsonApiWithClient("example.com", "bob", "hunter2", false, cl)
+	limiter := cpanelgo.NewLimiter(cpanelgo.Limit{MaxInFlight: 1})
+	release, _ := limiter.Acquire(context.Background())
+	limited := cpanel.CpanelApi{Api: cpanelgo.NewApi(api.Gateway.(*cpanel.JsonApiGateway).WithLimiter(limiter))}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := limited.GetThemeContext(ctx); !errors.Is(err, context.DeadlineExceeded) || requests != 0 {
+		t.Errorf("expected the call to wait for the limiter, got %d requests: %v", requests, err)
+	}
+	release()
+	if _, err := limited.GetTheme(); err != nil || requests != 1 {
+		t.Errorf("unexpected result after %d requests: %v", requests, err)
+	}
+}
+
+func TestJsonApiMethodPolicy(t *testing.T) {
+	tests := []struct {
+		function string
+		value    string
+		method   string
+	}{
+		{"get_theme_base", "", "GET"},
+		{"get_theme_base", strings.Repeat("x", 4096), "POST"},
+		{"install_ssl", "", "POST"},
+	}
+
+	for _, test := range tests {
+		var method, query, body string
+		cl := &http.Client{Transport: cpaneltest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+			method, query = req.Method, req.URL.RawQuery
+			if req.Body != nil {
+				b, _ := ioutil.ReadAll(req.Body)
+				body = string(b)
+			}
+			return cpaneltest.HTTPResponse(http.StatusOK, `{"status":1}`), nil
+		})}
+
+		api, _ := cpanel.NewJsonApiWithClient("example.com", "bob", "hunter2", false, cl)
+		var out cpanelgo.BaseUAPIResponse
+		if err := api.Gateway.UAPI("SSL", test.function, cpanelgo.Args{"value": test.value}, &out); err != nil {
+			t.Fatal(err)
+		}
+		if method != test.method {
+			t.Errorf("%s: expected %s, got: %s", test.function, test.method, method)
+		}
+		if params := query + body; !strings.Contains(params, "value=") || (method == "POST" && query != "") {
+			t.Errorf("%s: unexpected query %q and body %q", test.function, query, body)
+		}
+	}
+}
+
+func TestJsonApiPositionalArgs(t *testing.T) {
+	var query url.Values
+	var rawQuery string
+	cl := &http.Client{Transport: cpaneltest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		query, rawQuery = req.URL.Query(), req.URL.RawQuery
+		return cpaneltest.HTTPResponse(http.StatusOK, `{"apiversion":"1","data":{"result":"<html>"},"event":{"result":1}}`), nil
+	})}
+
+	api, _ := cpanel.NewJsonApiWithClient("example.com", "bob", "hunter2", false, cl)
+	var out cpanelgo.BaseAPI1Response
+	if err := api.Gateway.API1("Branding", "include", []string{"stdheader.html", "x=y"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if query.Get("arg-0") != "stdheader.html" || query.Get("arg-1") != "x=y" || query.Get("cpanel_jsonapi_apiversion") != "1" {
+		t.Errorf("unexpected query: %v", query)
+	}
+
+	// the positional arguments are sent in order, not sorted as strings
+	args := make([]string, 11)
+	for i := range args {
+		args[i] = strconv.Itoa(i)
+	}
+	if err := api.Gateway.API1("Branding", "include", args, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(rawQuery, "cpanel_jsonapi_user=bob&") || !strings.HasSuffix(rawQuery, "&arg-9=9&arg-10=10") {
+		t.Errorf("unexpected query: %s", rawQuery)
+	}
+}
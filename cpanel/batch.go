@@ -0,0 +1,153 @@
+package cpanel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/letsencrypt-cpanel/cpanelgo"
+)
+
+// Batch queues UAPI calls to send them as one Batch::strict request. cPanel runs
+// them in order and stops at the first which fails, so the calls after it fail
+// with cpanelgo.ErrBatchNotRun.
+type Batch struct {
+	api     CpanelApi
+	entries []batchEntry
+}
+
+type batchEntry struct {
+	call *cpanelgo.BatchCall
+	// decides the error of the call once its response was decoded
+	check func() error
+}
+
+func (c CpanelApi) NewBatch() *Batch {
+	return &Batch{api: c}
+}
+
+// Add queues a call of a UAPI function, whose response is decoded into out, a
+// pointer to a response type.
+func (b *Batch) Add(module, function string, args cpanelgo.Args, out interface{}) *cpanelgo.BatchCall {
+	return b.add(module, function, args, out, func() error {
+		return cpanelgo.ResponseError(out)
+	})
+}
+
+func (b *Batch) add(module, function string, args cpanelgo.Args, out interface{}, check func() error) *cpanelgo.BatchCall {
+	call := cpanelgo.NewBatchCall(module, function, args, out)
+	b.entries = append(b.entries, batchEntry{call: call, check: check})
+	return call
+}
+
+// Calls returns the queued calls, in order.
+func (b *Batch) Calls() []*cpanelgo.BatchCall {
+	calls := make([]*cpanelgo.BatchCall, len(b.entries))
+	for i, e := range b.entries {
+		calls[i] = e.call
+	}
+	return calls
+}
+
+// DomainsData queues CpanelApi.DomainsData.
+func (b *Batch) DomainsData(out *DomainsDataApiResponse) *cpanelgo.BatchCall {
+	return b.add("DomainInfo", "domains_data", cpanelgo.Args{"format": "hash"}, out, func() error {
+		err := out.Error()
+		if err == nil {
+			out.decodeSubdomains()
+		}
+		return err
+	})
+}
+
+// InstalledHosts queues CpanelApi.InstalledHosts.
+func (b *Batch) InstalledHosts(out *InstalledHostsApiResponse) *cpanelgo.BatchCall {
+	return b.add("SSL", "installed_hosts", nil, out, func() error {
+		return out.fatalError()
+	})
+}
+
+// WebVhostsListDomains queues CpanelApi.WebVhostsListDomains.
+func (b *Batch) WebVhostsListDomains(out *WebVhostsListDomainsApiResponse) *cpanelgo.BatchCall {
+	return b.Add("WebVhosts", "list_domains", nil, out)
+}
+
+type batchAPIResponse struct {
+	cpanelgo.BaseUAPIResponse
+	Data []json.RawMessage `json:"data"`
+}
+
+func (b *Batch) Do() error {
+	return b.DoContext(context.Background())
+}
+
+// DoContext sends the queued calls and decodes their responses. It fails if the
+// batch could not be sent, and otherwise returns the first error of the calls, whose
+// own errors are reported by their Err.
+func (b *Batch) DoContext(ctx context.Context) error {
+	if len(b.entries) == 0 {
+		return nil
+	}
+
+	commands := make([]string, len(b.entries))
+	for i, e := range b.entries {
+		cmd, err := batchCommand(e.call)
+		if err != nil {
+			return err
+		}
+		commands[i] = cmd
+	}
+
+	var out batchAPIResponse
+	err := b.api.UAPIContext(ctx, "Batch", "strict", cpanelgo.Args{"command": commands}, &out)
+	// a failed batch still carries the results of the calls up to the one which
+	// failed, whether or not the gateway or its interceptors report the failure
+	if len(out.Data) == 0 {
+		if err == nil {
+			err = out.Error()
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, e := range b.entries {
+		if i >= len(out.Data) {
+			e.call.Finish(cpanelgo.ErrBatchNotRun)
+			continue
+		}
+		err := cpanelgo.DecodeResult(out.Data[i], e.call.Out(), cpanelgo.ResponseInfo{
+			APIVersion: "uapi",
+			Module:     e.call.Module,
+			Function:   e.call.Function,
+		})
+		if err != nil {
+			e.call.Finish(err)
+			continue
+		}
+		e.call.Finish(e.check())
+	}
+	return cpanelgo.FirstError(b.Calls())
+}
+
+// batchCommand encodes a call the way Batch::strict takes it, as the JSON array
+// ["Module", "function", {"name": "value", ...}]
+func batchCommand(call *cpanelgo.BatchCall) (string, error) {
+	params, err := cpanelgo.EncodeArgs(call.Args, nil)
+	if err != nil {
+		return "", err
+	}
+	args := map[string]interface{}{}
+	for name, values := range params.Values() {
+		if len(values) == 1 {
+			args[name] = values[0]
+		} else {
+			args[name] = values
+		}
+	}
+	if call.Module == "" || call.Function == "" {
+		return "", errors.New("Batch call without module or function")
+	}
+	buf, err := json.Marshal([]interface{}{call.Module, call.Function, args})
+	return string(buf), err
+}
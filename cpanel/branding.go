@@ -1,6 +1,7 @@
 package cpanel
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/letsencrypt-cpanel/cpanelgo"
@@ -8,8 +9,12 @@ import (
 
 // This is fucking undocumented
 func (c CpanelApi) BrandingInclude(name string) (cpanelgo.BaseAPI1Response, error) {
+	return c.BrandingIncludeContext(context.Background(), name)
+}
+
+func (c CpanelApi) BrandingIncludeContext(ctx context.Context, name string) (cpanelgo.BaseAPI1Response, error) {
 	var out cpanelgo.BaseAPI1Response
-	err := c.Gateway.API1("Branding", "include", []string{name}, &out)
+	err := c.API1Context(ctx, "Branding", "include", []string{name}, &out)
 	if err == nil {
 		err = out.Error()
 	}
@@ -17,8 +22,12 @@ func (c CpanelApi) BrandingInclude(name string) (cpanelgo.BaseAPI1Response, erro
 }
 
 func (c CpanelApi) SetVar(key, value string) (cpanelgo.BaseAPI1Response, error) {
+	return c.SetVarContext(context.Background(), key, value)
+}
+
+func (c CpanelApi) SetVarContext(ctx context.Context, key, value string) (cpanelgo.BaseAPI1Response, error) {
 	var out cpanelgo.BaseAPI1Response
-	err := c.Gateway.API1("setvar", "", []string{fmt.Sprintf("%s=%s", key, value)}, &out)
+	err := c.API1Context(ctx, "setvar", "", []string{fmt.Sprintf("%s=%s", key, value)}, &out)
 	if err == nil {
 		err = out.Error()
 	}
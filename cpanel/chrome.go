@@ -1,6 +1,7 @@
 package cpanel
 
 import (
+	"context"
 	"github.com/letsencrypt-cpanel/cpanelgo"
 )
 
@@ -13,8 +14,12 @@ type GetDomAPIResponse struct {
 }
 
 func (c CpanelApi) GetDom(pageTitle string) (GetDomAPIResponse, error) {
+	return c.GetDomContext(context.Background(), pageTitle)
+}
+
+func (c CpanelApi) GetDomContext(ctx context.Context, pageTitle string) (GetDomAPIResponse, error) {
 	var out GetDomAPIResponse
-	err := c.Gateway.UAPI("Chrome", "get_dom", cpanelgo.Args{
+	err := c.UAPIContext(ctx, "Chrome", "get_dom", cpanelgo.Args{
 		"page_title": pageTitle,
 	}, &out)
 	if err == nil {
@@ -0,0 +1,182 @@
+package cpanel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/letsencrypt-cpanel/cpanelgo"
+)
+
+// Variables expanded by cpsrvd for <cpanel print="...">
+const (
+	LiveVarHomeDir      = "$homedir"
+	LiveVarContactEmail = "$CPDATA{'CONTACTEMAIL'}"
+	LiveVarMainDomain   = "$CPDATA{'DNS'}"
+)
+
+// CpanelIf evaluates a LiveAPI condition, e.g. "$haspostgres" or "!$isreseller",
+// as <cpanelif> does in cPanel templates.
+func (c *LiveApiGateway) CpanelIf(code string) (bool, error) {
+	return c.CpanelIfContext(context.Background(), code)
+}
+
+func (c *LiveApiGateway) CpanelIfContext(ctx context.Context, code string) (bool, error) {
+	if err := checkDirectiveValue(code); err != nil {
+		return false, err
+	}
+	result, err := c.directive(ctx, "cpanelif", "<cpanelif "+code+">")
+	if err != nil {
+		return false, err
+	}
+	return liveTruth(result)
+}
+
+// CpanelFeature reports whether the feature list of the account grants feature.
+func (c *LiveApiGateway) CpanelFeature(feature string) (bool, error) {
+	return c.CpanelFeatureContext(context.Background(), feature)
+}
+
+func (c *LiveApiGateway) CpanelFeatureContext(ctx context.Context, feature string) (bool, error) {
+	if err := checkDirectiveValue(feature); err != nil {
+		return false, err
+	}
+	result, err := c.directive(ctx, "cpanelfeature", "<cpanelfeature "+feature+">")
+	if err != nil {
+		return false, err
+	}
+	return liveTruth(result)
+}
+
+// CpanelPrint expands a LiveAPI variable, e.g. LiveVarHomeDir. Unknown variables
+// expand to an empty string.
+func (c *LiveApiGateway) CpanelPrint(variable string) (string, error) {
+	return c.CpanelPrintContext(context.Background(), variable)
+}
+
+func (c *LiveApiGateway) CpanelPrintContext(ctx context.Context, variable string) (string, error) {
+	if err := checkDirectiveValue(variable); err != nil {
+		return "", err
+	}
+	if strings.Contains(variable, `"`) {
+		return "", fmt.Errorf("Invalid LiveAPI variable: %q", variable)
+	}
+	result, err := c.directive(ctx, "cpanelprint", `<cpanel print="`+variable+`">`)
+	if err != nil {
+		return "", err
+	}
+	return liveString(result)
+}
+
+// HomeDir returns the home directory of the account.
+func (c *LiveApiGateway) HomeDir() (string, error) {
+	return c.CpanelPrint(LiveVarHomeDir)
+}
+
+func (c *LiveApiGateway) HomeDirContext(ctx context.Context) (string, error) {
+	return c.CpanelPrintContext(ctx, LiveVarHomeDir)
+}
+
+// ContactEmail returns the contact email address of the account.
+func (c *LiveApiGateway) ContactEmail() (string, error) {
+	return c.CpanelPrint(LiveVarContactEmail)
+}
+
+func (c *LiveApiGateway) ContactEmailContext(ctx context.Context) (string, error) {
+	return c.CpanelPrintContext(ctx, LiveVarContactEmail)
+}
+
+// MainDomain returns the main domain of the account.
+func (c *LiveApiGateway) MainDomain() (string, error) {
+	return c.CpanelPrint(LiveVarMainDomain)
+}
+
+func (c *LiveApiGateway) MainDomainContext(ctx context.Context) (string, error) {
+	return c.CpanelPrintContext(ctx, LiveVarMainDomain)
+}
+
+// directive sends a LiveAPI directive and returns the result it expands to, which
+// cpsrvd wraps as {"cpanelresult":{"data":{"result":...}}} in JSON mode
+func (c *LiveApiGateway) directive(ctx context.Context, name, req string) (json.RawMessage, error) {
+	l := c.logger()
+	if l.Enabled(cpanelgo.LogDebug) {
+		l.Log(cpanelgo.LogDebug, "LiveAPI directive", cpanelgo.Fields{"directive": req})
+	}
+
+	info := cpanelgo.ResponseInfo{Function: name}
+	var out struct {
+		cpanelgo.BaseResult
+		Result struct {
+			Data struct {
+				Result json.RawMessage `json:"result"`
+			} `json:"data"`
+		} `json:"cpanelresult"`
+	}
+	err := c.action(ctx, nil, req, &out, &info)
+	if err == nil {
+		cpanelgo.SetResponseInfo(&out, info)
+		err = out.Error()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return out.Result.Data.Result, nil
+}
+
+// checkDirectiveValue rejects values which would end the directive early
+func checkDirectiveValue(v string) error {
+	if v == "" || strings.ContainsAny(v, "<>\n") {
+		return fmt.Errorf("Invalid LiveAPI directive value: %q", v)
+	}
+	return nil
+}
+
+// liveTruth interprets the result of a condition, which cpsrvd returns as 1 or 0,
+// either as a number or a string, or as an empty string for false
+func liveTruth(raw json.RawMessage) (bool, error) {
+	var v interface{}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return false, err
+		}
+	}
+	switch v := v.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return v, nil
+	case float64:
+		return v != 0, nil
+	case string:
+		if v == "" {
+			return false, nil
+		}
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return false, fmt.Errorf("Unexpected LiveAPI condition result: %q", v)
+		}
+		return n != 0, nil
+	}
+	return false, fmt.Errorf("Unexpected LiveAPI condition result: %s", raw)
+}
+
+// liveString interprets the result of a variable expansion
+func liveString(raw json.RawMessage) (string, error) {
+	var v interface{}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return "", err
+		}
+	}
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case float64, bool:
+		return string(raw), nil
+	}
+	return "", fmt.Errorf("Unexpected LiveAPI variable value: %s", raw)
+}
@@ -1,6 +1,7 @@
 package cpanel
 
 import (
+	"context"
 	"encoding/json"
 
 	"github.com/letsencrypt-cpanel/cpanelgo"
@@ -50,27 +51,35 @@ func (r DomainsDataApiResponse) DomainList() []string {
 }
 
 func (c CpanelApi) DomainsData() (DomainsDataApiResponse, error) {
+	return c.DomainsDataContext(context.Background())
+}
+
+func (c CpanelApi) DomainsDataContext(ctx context.Context) (DomainsDataApiResponse, error) {
 	var out DomainsDataApiResponse
 
-	err := c.Gateway.UAPI("DomainInfo", "domains_data", cpanelgo.Args{
+	err := c.UAPIContext(ctx, "DomainInfo", "domains_data", cpanelgo.Args{
 		"format": "hash",
 	}, &out)
 	if err == nil {
 		err = out.Error()
 	}
 	if err == nil {
-		out.Data.Subdomains = []DomainsDataDomain{}
-		for _, v := range out.Data.Sub_Domains {
-			dec := DomainsDataDomain{}
-			if err := json.Unmarshal(v, &dec); err == nil {
-				out.Data.Subdomains = append(out.Data.Subdomains, dec)
-			}
-		}
-
+		out.decodeSubdomains()
 	}
 	return out, err
 }
 
+// decodeSubdomains fills Subdomains from the entries of sub_domains which decode
+func (r *DomainsDataApiResponse) decodeSubdomains() {
+	r.Data.Subdomains = []DomainsDataDomain{}
+	for _, v := range r.Data.Sub_Domains {
+		dec := DomainsDataDomain{}
+		if err := json.Unmarshal(v, &dec); err == nil {
+			r.Data.Subdomains = append(r.Data.Subdomains, dec)
+		}
+	}
+}
+
 type SingleDomainDataApiResponse struct {
 	Status int `json:"status"`
 	Data   struct {
@@ -80,9 +89,13 @@ type SingleDomainDataApiResponse struct {
 }
 
 func (c CpanelApi) SingleDomainData(domain string) (SingleDomainDataApiResponse, error) {
+	return c.SingleDomainDataContext(context.Background(), domain)
+}
+
+func (c CpanelApi) SingleDomainDataContext(ctx context.Context, domain string) (SingleDomainDataApiResponse, error) {
 	var out SingleDomainDataApiResponse
 
-	err := c.Gateway.UAPI("DomainInfo", "single_domain_data", cpanelgo.Args{
+	err := c.UAPIContext(ctx, "DomainInfo", "single_domain_data", cpanelgo.Args{
 		"domain": domain,
 	}, &out)
 
@@ -101,9 +114,13 @@ type ListParkedDomainsApiResponse struct {
 }
 
 func (c CpanelApi) ListParkedDomains() (ListParkedDomainsApiResponse, error) {
+	return c.ListParkedDomainsContext(context.Background())
+}
+
+func (c CpanelApi) ListParkedDomainsContext(ctx context.Context) (ListParkedDomainsApiResponse, error) {
 	var out ListParkedDomainsApiResponse
 
-	err := c.Gateway.API2("Park", "listparkeddomains", cpanelgo.Args{}, &out)
+	err := c.API2Context(ctx, "Park", "listparkeddomains", cpanelgo.Args{}, &out)
 
 	if err == nil {
 		err = out.Error()
@@ -150,9 +167,13 @@ func (r WebVhostsListDomainsApiResponse) GetAllProxySubdomains() []string {
 }
 
 func (c CpanelApi) WebVhostsListDomains() (WebVhostsListDomainsApiResponse, error) {
+	return c.WebVhostsListDomainsContext(context.Background())
+}
+
+func (c CpanelApi) WebVhostsListDomainsContext(ctx context.Context) (WebVhostsListDomainsApiResponse, error) {
 	var out WebVhostsListDomainsApiResponse
 
-	err := c.Gateway.UAPI("WebVhosts", "list_domains", cpanelgo.Args{}, &out)
+	err := c.UAPIContext(ctx, "WebVhosts", "list_domains", cpanelgo.Args{}, &out)
 
 	if err == nil {
 		err = out.Error()
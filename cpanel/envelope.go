@@ -0,0 +1,173 @@
+package cpanel
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+
+	"github.com/letsencrypt-cpanel/cpanelgo"
+)
+
+// liveEnvelope is one <cpanelresult> element read from the LiveAPI socket, e.g.
+//
+//	<?xml version="1.0" ?>
+//	<cpanelresult><error>A warning occurred while processing this directive.</error>{...}</cpanelresult>
+type liveEnvelope struct {
+	// The JSON payload, nil if there was none
+	JSON json.RawMessage
+	// Text of the <error> elements, the way cpsrvd reports warnings raised while
+	// processing a request, or why it could not process it at all
+	Errors []string
+	// Any text outside of elements and the JSON payload
+	Text string
+	// Number of bytes read, including what preceded <cpanelresult>
+	Size int64
+}
+
+// envelopeReader reads envelopes off a LiveAPI stream without consuming anything
+// past the end of the envelope, so that the next one can be read from the same
+// bufio.Reader.
+type envelopeReader struct {
+	rd    *bufio.Reader
+	limit int64
+	read  int64
+	// whether anything but whitespace was read
+	content bool
+}
+
+// readLiveEnvelope reads the next envelope from rd, reading at most limit bytes.
+// The JSON payload is delimited by its own structure, so it may contain anything,
+// including HTML and </cpanelresult>. Whatever precedes <cpanelresult>, such as the
+// XML declaration, newlines or stray output, is skipped. The envelope is returned
+// even on error, to report how much was read.
+func readLiveEnvelope(rd *bufio.Reader, limit int64) (*liveEnvelope, error) {
+	r := &envelopeReader{rd: rd, limit: limit}
+	env := &liveEnvelope{}
+	err := r.envelope(env)
+	env.Size = r.read
+	return env, err
+}
+
+func (r *envelopeReader) envelope(env *liveEnvelope) error {
+	if _, err := r.readUntil("<cpanelresult>"); err != nil {
+		return err
+	}
+
+	var text strings.Builder
+	for {
+		b, err := r.readByte()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case b == '<':
+			tag, err := r.readUntil(">")
+			if err != nil {
+				return err
+			}
+			if tag == "/cpanelresult" {
+				env.Text = strings.TrimSpace(text.String())
+				return nil
+			}
+			if strings.HasSuffix(tag, "/") || strings.HasPrefix(tag, "!") || strings.HasPrefix(tag, "?") {
+				// empty element, comment or processing instruction
+				continue
+			}
+			name := strings.Fields(tag)
+			if len(name) == 0 {
+				return fmt.Errorf("Malformed LiveAPI response: empty tag after %d bytes", r.read)
+			}
+			content, err := r.readUntil("</" + name[0] + ">")
+			if err != nil {
+				return err
+			}
+			if name[0] == "error" {
+				env.Errors = append(env.Errors, html.UnescapeString(strings.TrimSpace(content)))
+			}
+		case (b == '{' || b == '[') && env.JSON == nil:
+			raw, err := r.readJSON(b)
+			if err != nil {
+				return err
+			}
+			env.JSON = raw
+		default:
+			text.WriteByte(b)
+		}
+	}
+}
+
+func (r *envelopeReader) readByte() (byte, error) {
+	b, err := r.rd.ReadByte()
+	if err == io.EOF {
+		if !r.content {
+			return 0, fmt.Errorf("%w: connection closed without a response", ErrIncompleteResponse)
+		}
+		return 0, fmt.Errorf("%w: connection closed after %d bytes", ErrIncompleteResponse, r.read)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	r.read++
+	// limit memory footprint of any api response
+	if r.read > r.limit {
+		return 0, &cpanelgo.ResponseTooLargeError{Limit: r.limit, Read: r.read}
+	}
+	if !r.content && !isSpace(b) {
+		r.content = true
+	}
+	return b, nil
+}
+
+// readUntil reads up to and including delim, returning what preceded it
+func (r *envelopeReader) readUntil(delim string) (string, error) {
+	var buf strings.Builder
+	for {
+		b, err := r.readByte()
+		if err != nil {
+			return "", err
+		}
+		buf.WriteByte(b)
+		if b == delim[len(delim)-1] && strings.HasSuffix(buf.String(), delim) {
+			s := buf.String()
+			return s[:len(s)-len(delim)], nil
+		}
+	}
+}
+
+// readJSON reads the rest of the JSON object or array opened by first
+func (r *envelopeReader) readJSON(first byte) (json.RawMessage, error) {
+	buf := []byte{first}
+	depth := 1
+	inString, escaped := false, false
+	for depth > 0 {
+		b, err := r.readByte()
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, b)
+
+		switch {
+		case escaped:
+			escaped = false
+		case inString && b == '\\':
+			escaped = true
+		case b == '"':
+			inString = !inString
+		case inString:
+		case b == '{' || b == '[':
+			depth++
+		case b == '}' || b == ']':
+			depth--
+		}
+	}
+	return buf, nil
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\r' || b == '\n'
+}
@@ -1,17 +1,27 @@
 package cpanel
 
-import "github.com/letsencrypt-cpanel/cpanelgo"
+import (
+	"context"
+	"errors"
+
+	"github.com/letsencrypt-cpanel/cpanelgo"
+)
 
 func (c CpanelApi) HasFeature(name string) (string, error) {
+	return c.HasFeatureContext(context.Background(), name)
+}
+
+func (c CpanelApi) HasFeatureContext(ctx context.Context, name string) (string, error) {
 	var out cpanelgo.BaseUAPIResponse
-	err := c.Gateway.UAPI("Features", "has_feature", cpanelgo.Args{
+	err := c.UAPIContext(ctx, "Features", "has_feature", cpanelgo.Args{
 		"name": name,
 	}, &out)
 	if err == nil {
 		err = out.Error()
 	}
 	// discard the error if its the 'unknown error' as its irrelevant to the result
-	if err != nil && err.Error() == cpanelgo.ErrorUnknown {
+	var apiErr *cpanelgo.APIError
+	if errors.As(err, &apiErr) && apiErr.Unknown() {
 		err = nil
 	}
 	return out.Message(), err
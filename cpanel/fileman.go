@@ -1,6 +1,10 @@
 package cpanel
 
-import "github.com/letsencrypt-cpanel/cpanelgo"
+import (
+	"context"
+
+	"github.com/letsencrypt-cpanel/cpanelgo"
+)
 
 type MkdirApiResponse struct {
 	cpanelgo.BaseAPI2Response
@@ -12,8 +16,12 @@ type MkdirApiResponse struct {
 }
 
 func (c CpanelApi) Mkdir(name, permissions, path string) (MkdirApiResponse, error) {
+	return c.MkdirContext(context.Background(), name, permissions, path)
+}
+
+func (c CpanelApi) MkdirContext(ctx context.Context, name, permissions, path string) (MkdirApiResponse, error) {
 	var out MkdirApiResponse
-	err := c.Gateway.API2("Fileman", "mkdir", cpanelgo.Args{
+	err := c.API2Context(ctx, "Fileman", "mkdir", cpanelgo.Args{
 		"path":        path,
 		"permissions": permissions,
 		"name":        name,
@@ -33,8 +41,12 @@ type UploadFilesApiResponse struct {
 }
 
 func (c CpanelApi) UploadFiles(name, contents, dir string) error {
+	return c.UploadFilesContext(context.Background(), name, contents, dir)
+}
+
+func (c CpanelApi) UploadFilesContext(ctx context.Context, name, contents, dir string) error {
 	var out UploadFilesApiResponse
-	err := c.Gateway.UAPI("Fileman", "upload_files", cpanelgo.Args{
+	err := c.UAPIContext(ctx, "Fileman", "upload_files", cpanelgo.Args{
 		"dir":         dir,
 		"name":        name,
 		"contents":    contents,
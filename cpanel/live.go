@@ -2,199 +2,428 @@ package cpanel
 
 import (
 	"bufio"
-	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"net"
-	"strings"
-
-	"log"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/letsencrypt-cpanel/cpanelgo"
 )
 
 type LiveApiGateway struct {
 	net.Conn
+	// Run around every call made through the gateway
+	Interceptors cpanelgo.Interceptors
+	// Defaults to cpanelgo.DefaultLogger()
+	Logger cpanelgo.Logger
+	// Maximum size of a response in bytes, defaults to cpanelgo.ResponseSizeLimit
+	ResponseSizeLimit int64
+
+	// serialises exchanges on the socket, and guards the fields below
+	mu sync.Mutex
+	// reads responses from rdConn, kept across calls so nothing read ahead is lost
+	rd     *bufio.Reader
+	rdConn net.Conn
+	// where to reconnect to, unknown when the gateway was given a connection
+	network, address string
+	// the socket failed or lost track of the framing and must be replaced
+	broken bool
+	closed bool
+}
+
+func (c *LiveApiGateway) logger() cpanelgo.Logger {
+	if c.Logger == nil {
+		return cpanelgo.DefaultLogger()
+	}
+	return c.Logger
+}
+
+// ErrNotUnderCpsrvd is returned by NewLiveApiFromEnv when the environment cPanel
+// provides to plugin CGIs is missing
+var ErrNotUnderCpsrvd = errors.New("not running under cpsrvd: no LiveAPI socket in the environment")
+
+// Environment variables naming the LiveAPI socket, in order of preference. The
+// older ones are still set by some cPanel versions.
+var liveApiSocketEnv = []string{
+	"CPANEL_CONNECT_FILE",
+	"CPANEL_CONNECT_SOCKET",
+	"CPANEL_PHPCONNECT_SOCKET",
 }
 
+// ErrIncompleteResponse is returned when the LiveAPI socket closes before the
+// response is terminated by </cpanelresult>
+var ErrIncompleteResponse = errors.New("incomplete LiveAPI response")
+
+var (
+	errLiveApiClosed = errors.New("use of closed LiveAPI gateway")
+	errLiveApiBroken = errors.New("LiveAPI socket is broken and the gateway does not know where to reconnect")
+)
+
+// How long Close waits for cpsrvd to acknowledge the shutdown
+const liveApiShutdownTimeout = time.Second
+
 func NewLiveApi(network, address string) (CpanelApi, error) {
-	c := &LiveApiGateway{}
+	return NewLiveApiContext(context.Background(), network, address)
+}
 
-	conn, err := net.Dial(network, address)
-	if err != nil {
+func NewLiveApiContext(ctx context.Context, network, address string) (CpanelApi, error) {
+	c := &LiveApiGateway{network: network, address: address}
+	if err := c.connect(ctx); err != nil {
 		return CpanelApi{}, err
 	}
+	return CpanelApi{cpanelgo.NewApi(c)}, nil
+}
+
+// connect dials the socket and enables JSON on it
+func (c *LiveApiGateway) connect(ctx context.Context) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return err
+	}
 	c.Conn = conn
+	c.broken = false
 
-	if err := c.exec(`<cpaneljson enable="1">`, nil); err != nil {
-		return CpanelApi{}, fmt.Errorf("Enabling JSON: %v", err)
+	if _, _, err := c.roundTrip(ctx, nil, `<cpaneljson enable="1">`); err != nil {
+		conn.Close()
+		c.broken = true
+		return fmt.Errorf("Enabling JSON: %w", err)
 	}
+	return nil
+}
 
-	return CpanelApi{cpanelgo.NewApi(c)}, nil
+// reconnect replaces a broken socket, if the gateway knows where to dial
+func (c *LiveApiGateway) reconnect(ctx context.Context) error {
+	if c.network == "" {
+		return errLiveApiBroken
+	}
+	if c.Conn != nil {
+		c.Conn.Close()
+	}
+	if err := c.connect(ctx); err != nil {
+		return fmt.Errorf("Reconnecting to LiveAPI socket %s: %w", c.address, err)
+	}
+	return nil
 }
 
-func (c *LiveApiGateway) UAPI(module, function string, arguments cpanelgo.Args, out interface{}) error {
-	req := CpanelApiRequest{
-		RequestType: "exec",
-		ApiVersion:  "uapi",
-		Module:      module,
-		Function:    function,
-		Arguments:   arguments,
+// NewLiveApiFromEnv connects to the LiveAPI socket cpsrvd names in the environment
+// of plugin CGIs, failing with ErrNotUnderCpsrvd when there is none. Closing the
+// returned api performs the shutdown handshake, which may block for up to a second
+// if cpsrvd does not answer it.
+func NewLiveApiFromEnv() (CpanelApi, error) {
+	return NewLiveApiFromEnvContext(context.Background())
+}
+
+func NewLiveApiFromEnvContext(ctx context.Context) (CpanelApi, error) {
+	for _, name := range liveApiSocketEnv {
+		if path := os.Getenv(name); path != "" {
+			api, err := NewLiveApiContext(ctx, "unix", path)
+			if err != nil {
+				return api, fmt.Errorf("Connecting to LiveAPI socket %s from %s: %w", path, name, err)
+			}
+			return api, nil
+		}
 	}
+	return CpanelApi{}, ErrNotUnderCpsrvd
+}
+
+func (c *LiveApiGateway) UAPI(module, function string, arguments cpanelgo.Args, out interface{}) error {
+	return c.UAPIContext(context.Background(), module, function, arguments, out)
+}
 
-	return c.api(req, out)
+func (c *LiveApiGateway) UAPIContext(ctx context.Context, module, function string, arguments cpanelgo.Args, out interface{}) error {
+	return c.Interceptors.Invoke(ctx, &cpanelgo.Call{
+		APIVersion: "uapi",
+		Module:     module,
+		Function:   function,
+		Args:       arguments,
+	}, out, c.api)
 }
 
 func (c *LiveApiGateway) API2(module, function string, arguments cpanelgo.Args, out interface{}) error {
-	req := CpanelApiRequest{
-		RequestType: "exec",
-		ApiVersion:  "2",
-		Module:      module,
-		Function:    function,
-		Arguments:   arguments,
-	}
+	return c.API2Context(context.Background(), module, function, arguments, out)
+}
 
-	return c.api(req, out)
+func (c *LiveApiGateway) API2Context(ctx context.Context, module, function string, arguments cpanelgo.Args, out interface{}) error {
+	return c.Interceptors.Invoke(ctx, &cpanelgo.Call{
+		APIVersion: "2",
+		Module:     module,
+		Function:   function,
+		Args:       arguments,
+	}, out, c.api)
 }
 
 func (c *LiveApiGateway) API1(module, function string, arguments []string, out interface{}) error {
-	req := map[string]interface{}{
-		"module":     module,
-		"reqtype":    "exec",
-		"func":       function,
-		"apiversion": "1",
-		"args":       arguments,
-	}
-	bytes, err := json.Marshal(req)
-	if err != nil {
-		return err
-	}
+	return c.API1Context(context.Background(), module, function, arguments, out)
+}
 
-	return c.exec("<cpanelaction>"+string(bytes)+"</cpanelaction>", out)
+func (c *LiveApiGateway) API1Context(ctx context.Context, module, function string, arguments []string, out interface{}) error {
+	return c.Interceptors.Invoke(ctx, &cpanelgo.Call{
+		APIVersion:     "1",
+		Module:         module,
+		Function:       function,
+		PositionalArgs: arguments,
+	}, out, c.api)
 }
 
+// Close ends the session with the shutdown handshake cpsrvd expects, then closes
+// the socket. The handshake waits for at most liveApiShutdownTimeout, and its
+// failure is ignored.
 func (c *LiveApiGateway) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	if c.broken {
+		// already closed when it broke
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), liveApiShutdownTimeout)
+	defer cancel()
+	// best effort, cpsrvd may close the socket without answering
+	c.roundTrip(ctx, nil, `<cpanelxml shutdown="1" />`)
+	if c.broken {
+		// closed by the failed handshake
+		return nil
+	}
 	return c.Conn.Close()
 }
 
-func (c *LiveApiGateway) api(req CpanelApiRequest, out interface{}) error {
+// api performs the call once it has passed through the interceptors
+func (c *LiveApiGateway) api(ctx context.Context, call *cpanelgo.Call, out interface{}) error {
+	args, err := liveArgs(call.Args)
+	if err != nil {
+		return err
+	}
+	var req interface{} = CpanelApiRequest{
+		RequestType: "exec",
+		ApiVersion:  call.APIVersion,
+		Module:      call.Module,
+		Function:    call.Function,
+		Arguments:   args,
+	}
+	if call.APIVersion == "1" {
+		req = map[string]interface{}{
+			"module":     call.Module,
+			"reqtype":    "exec",
+			"func":       call.Function,
+			"apiversion": "1",
+			"args":       call.PositionalArgs,
+		}
+	}
+
 	buf, err := json.Marshal(req)
 	if err != nil {
 		return err
 	}
-	if os.Getenv("DEBUG_CPANEL_RESPONSES") == "1" {
-		log.Println("[Lets Encrypt for cPanel] Request: ", string(buf))
+	l := c.logger()
+	if l.Enabled(cpanelgo.LogDebug) {
+		l.Log(cpanelgo.LogDebug, "LiveAPI request", call.LogFields())
+	}
+	info := cpanelgo.ResponseInfo{
+		APIVersion: call.APIVersion,
+		Module:     call.Module,
+		Function:   call.Function,
 	}
-	switch req.ApiVersion {
+	action := "<cpanelaction>" + string(buf) + "</cpanelaction>"
+	switch call.APIVersion {
 	case "uapi":
 		var result cpanelgo.UAPIResult
-		err := c.exec("<cpanelaction>"+string(buf)+"</cpanelaction>", &result)
-		if err == nil {
-			err = result.Error()
+		if err := c.action(ctx, call, action, &result, &info); err != nil {
+			return err
 		}
-		if err != nil {
+		cpanelgo.SetResponseInfo(&result, info)
+		if err := result.Error(); err != nil {
+			// keep whatever result came with the failure, e.g. the calls of a batch
+			// which ran before it failed
+			if len(result.Result) > 0 && string(result.Result) != "null" {
+				cpanelgo.DecodeResult(result.Result, out, info)
+			}
 			return err
 		}
 
-		if os.Getenv("DEBUG_CPANEL_RESPONSES") == "1" {
-			log.Println("[Lets Encrypt for cPanel] UResult: ", string(result.Result))
+		if l.Enabled(cpanelgo.LogDebug) {
+			fields := call.LogFields()
+			fields["result"] = cpanelgo.RedactBody(result.Result)
+			l.Log(cpanelgo.LogDebug, "LiveAPI response", fields)
 		}
-		return json.Unmarshal(result.Result, out)
+		return cpanelgo.DecodeResult(result.Result, out, info)
 	case "2":
 		var result cpanelgo.API2Result
-		err := c.exec("<cpanelaction>"+string(buf)+"</cpanelaction>", &result)
+		err := c.action(ctx, call, action, &result, &info)
 		if err == nil {
+			cpanelgo.SetResponseInfo(&result, info)
 			err = result.Error()
 		}
 		if err != nil {
 			return err
 		}
-		if os.Getenv("DEBUG_CPANEL_RESPONSES") == "1" {
-			log.Println("[Lets Encrypt for cPanel] 2Result: ", string(result.Result))
+		if l.Enabled(cpanelgo.LogDebug) {
+			fields := call.LogFields()
+			fields["result"] = cpanelgo.RedactBody(result.Result)
+			l.Log(cpanelgo.LogDebug, "LiveAPI response", fields)
 		}
-		return json.Unmarshal(result.Result, out)
+		return cpanelgo.DecodeResult(result.Result, out, info)
 	default:
-		return c.exec("<cpanelaction>"+string(buf)+"</cpanelaction>", out)
+		err := c.action(ctx, call, action, out, &info)
+		if err == nil {
+			cpanelgo.SetResponseInfo(out, info)
+		}
+		return err
 	}
 }
 
-func endsWith(where []byte, what string) bool {
-	n := 0
-	i := len(where) - len(what)
-	if i < 0 {
-		return false
+// action sends req and unmarshals the JSON payload of the response into out. The
+// warnings of the envelope are added to info.
+func (c *LiveApiGateway) action(ctx context.Context, call *cpanelgo.Call, req string, out interface{}, info *cpanelgo.ResponseInfo) error {
+	env, err := c.exec(ctx, call, req)
+	if err != nil {
+		return err
 	}
-	for ; i >= 0 && i < len(where); i++ {
-		if where[i] != what[n] {
-			return false
+	if env.JSON == nil {
+		// cpsrvd could not run the call at all
+		if len(env.Errors) > 0 {
+			return info.NewAPIError(env.Errors, nil, nil)
 		}
-		n++
+		return fmt.Errorf("No JSON in LiveAPI response: %q", env.Text)
+	}
+	info.Warnings = env.Errors
+	if out == nil {
+		return nil
 	}
-	return true
+	return json.Unmarshal(env.JSON, out)
 }
 
-func extractJSONString(s string) (string, error) {
-	needles := []string{
-		"<cpanelresult>{",
-		"</error>{",
-		">{",
+// liveArgs converts args for the JSON of a LiveAPI request. Values are encoded by
+// cpanelgo.EncodeArgs, as the HTTP gateways send them, so that cPanel receives the
+// same strings whichever way it is called. Only the arguments sent several times are
+// kept as JSON arrays of their encoded values.
+func liveArgs(args cpanelgo.Args) (cpanelgo.Args, error) {
+	if args == nil {
+		return nil, nil
 	}
-	var found bool
-	for _, needle := range needles {
-		pos := strings.Index(s, needle)
-		if pos == -1 {
-			continue
+	params, err := cpanelgo.EncodeArgs(args, nil)
+	if err != nil {
+		return nil, err
+	}
+	out := make(cpanelgo.Args, len(params))
+	for _, p := range params {
+		switch prev := out[p.Name].(type) {
+		case nil:
+			out[p.Name] = p.Value
+		case string:
+			out[p.Name] = []string{prev, p.Value}
+		case []string:
+			out[p.Name] = append(prev, p.Value)
 		}
-		s = s[pos+len(needle)-1:]
-		found = true
-		break
 	}
-	if !found {
-		return "", fmt.Errorf("Could not find start of JSON in: %s", s)
+	return out, nil
+}
+
+// watchContext applies the deadline of ctx to the socket and interrupts any blocked
+// read or write when ctx is cancelled. The returned function must be called once
+// the exchange is over.
+func (c *LiveApiGateway) watchContext(ctx context.Context) func() {
+	if dl, ok := ctx.Deadline(); ok {
+		c.SetDeadline(dl)
+	}
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	if ctx.Done() != nil {
+		go func() {
+			defer close(exited)
+			select {
+			case <-ctx.Done():
+				c.SetDeadline(time.Unix(1, 0))
+			case <-done:
+			}
+		}()
+	} else {
+		close(exited)
 	}
-	eof := strings.Index(s, "</cpanelresult>")
-	if eof == -1 {
-		return "", fmt.Errorf("Does not appear to be well-formed: %s", s)
+	return func() {
+		close(done)
+		<-exited
+		c.SetDeadline(time.Time{})
 	}
-	return s[:eof], nil
 }
 
-func (c *LiveApiGateway) exec(req string, out interface{}) error {
-	if _, err := fmt.Fprintf(c, "%d\n%s", len(req), req); err != nil {
-		return err
+// exec sends req and reads the envelope of the response. Exchanges are serialised,
+// so the gateway may be used from several goroutines. A socket which broke during
+// an earlier exchange is replaced first, and a request which could not be written
+// is sent again once over a new socket, as cpsrvd never saw it.
+func (c *LiveApiGateway) exec(ctx context.Context, call *cpanelgo.Call, req string) (*liveEnvelope, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
-	var read bytes.Buffer
-	rd := bufio.NewReader(c)
-
-	line, _, err := rd.ReadLine() // ignore isprefix
-	for err == nil {
-		read.Write(line)
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-		if endsWith(read.Bytes(), "</cpanelresult>") {
-			break
+	if c.closed {
+		return nil, errLiveApiClosed
+	}
+	if c.broken {
+		if err := c.reconnect(ctx); err != nil {
+			return nil, err
 		}
+	}
 
-		// limit memory footprint of any api response
-		if read.Len() >= cpanelgo.ResponseSizeLimit {
-			return errors.New("Exceeded maximum API response size")
+	env, sent, err := c.roundTrip(ctx, call, req)
+	if err != nil && !sent && c.network != "" && ctx.Err() == nil {
+		if err := c.reconnect(ctx); err != nil {
+			return nil, err
 		}
-		line, _, err = rd.ReadLine()
-	}
-	if err != nil && err != io.EOF {
-		return err
+		env, _, err = c.roundTrip(ctx, call, req)
 	}
+	return env, err
+}
 
-	if out == nil {
-		return nil
+// roundTrip performs one exchange on the current socket, reporting whether the
+// request was written. Once the exchange fails at the socket level the stream can
+// no longer be trusted, so the socket is closed and marked broken.
+func (c *LiveApiGateway) roundTrip(ctx context.Context, call *cpanelgo.Call, req string) (*liveEnvelope, bool, error) {
+	defer c.watchContext(ctx)()
+
+	if _, err := fmt.Fprintf(c.Conn, "%d\n%s", len(req), req); err != nil {
+		return nil, false, c.fail(ctx, err)
 	}
 
-	asJSON, err := extractJSONString(read.String())
+	if c.rd == nil || c.rdConn != c.Conn {
+		c.rd = bufio.NewReader(c.Conn)
+		c.rdConn = c.Conn
+	}
+	env, err := readLiveEnvelope(c.rd, cpanelgo.SizeLimit(c.ResponseSizeLimit))
+	if call != nil {
+		call.ResponseSize = env.Size
+	}
 	if err != nil {
-		return err
+		return nil, true, c.fail(ctx, err)
+	}
+	return env, true, nil
+}
+
+// fail marks the socket broken and returns the error to report for err
+func (c *LiveApiGateway) fail(ctx context.Context, err error) error {
+	c.broken = true
+	c.Conn.Close()
+
+	// report the cancellation rather than the i/o timeout it caused
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		if dl, ok := ctx.Deadline(); ok && !time.Now().Before(dl) {
+			return context.DeadlineExceeded
+		}
 	}
-	return json.Unmarshal([]byte(asJSON), out)
+	return err
 }
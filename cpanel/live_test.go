@@ -1,8 +1,18 @@
 package cpanel
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/letsencrypt-cpanel/cpanelgo"
 )
 
 func TestLiveAPIUnmarshal(t *testing.T) {
@@ -15,13 +25,71 @@ func TestLiveAPIUnmarshal(t *testing.T) {
 
 	var out interface{}
 	for _, input := range inputs {
-		s, err := extractJSONString(input)
+		env, err := readLiveEnvelope(bufio.NewReader(strings.NewReader(input)), 1024)
 		if err != nil {
-			t.Errorf("%s when extracting JSON from: %s", err, input)
+			t.Errorf("%s when reading envelope: %s", err, input)
 			continue
 		}
-		if err := json.Unmarshal([]byte(s), &out); err != nil {
-			t.Errorf("%s when unmarshaling JSON from: %s", err, s)
+		if err := json.Unmarshal(env.JSON, &out); err != nil {
+			t.Errorf("%s when unmarshaling JSON from: %s", err, env.JSON)
 		}
 	}
 }
+
+func TestLiveAPIEnvelope(t *testing.T) {
+	html := `{"result":{"data":"<div class=\"x\">{</div></cpanelresult>>{\\"}}`
+	stream := "<?xml version=\"1.0\" ?>\n<cpanelresult>\n<error>Warning &amp; more</error>\n<error>Second</error>\n" + html + "\n</cpanelresult>\n" +
+		"<?xml version=\"1.0\" ?>\n<cpanelresult>[1, [2]]</cpanelresult>" +
+		"<cpanelresult><error>Function does not exist</error></cpanelresult>\n" +
+		"<cpanelresult>{\"data\""
+	rd := bufio.NewReader(strings.NewReader(stream))
+
+	env, err := readLiveEnvelope(rd, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(env.JSON) != html || !reflect.DeepEqual(env.Errors, []string{"Warning & more", "Second"}) {
+		t.Errorf("unexpected first envelope: %s, %q", env.JSON, env.Errors)
+	}
+
+	env, err = readLiveEnvelope(rd, 1024)
+	if err != nil || string(env.JSON) != "[1, [2]]" || env.Errors != nil {
+		t.Errorf("unexpected second envelope: %+v, %v", env, err)
+	}
+
+	env, err = readLiveEnvelope(rd, 1024)
+	if err != nil || env.JSON != nil || !reflect.DeepEqual(env.Errors, []string{"Function does not exist"}) {
+		t.Errorf("unexpected third envelope: %+v, %v", env, err)
+	}
+
+	if _, err := readLiveEnvelope(rd, 1024); !errors.Is(err, ErrIncompleteResponse) {
+		t.Errorf("expected %v, got: %v", ErrIncompleteResponse, err)
+	}
+	if _, err := readLiveEnvelope(rd, 1024); err == nil || !strings.Contains(err.Error(), "without a response") {
+		t.Errorf("expected no response, got: %v", err)
+	}
+
+	var tooLarge *cpanelgo.ResponseTooLargeError
+	if _, err := readLiveEnvelope(bufio.NewReader(strings.NewReader(stream)), 64); !errors.As(err, &tooLarge) {
+		t.Errorf("expected the response to be too large, got: %v", err)
+	}
+}
+
+func TestLiveAPIContextDeadline(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	// swallow the request and never answer
+	go ioutil.ReadAll(server)
+
+	gw := &LiveApiGateway{Conn: client}
+	defer gw.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	var out interface{}
+	err := gw.UAPIContext(ctx, "Themes", "get_theme_base", nil, &out)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected %v, got: %v", context.DeadlineExceeded, err)
+	}
+}
@@ -1,6 +1,10 @@
 package cpanel
 
-import "github.com/letsencrypt-cpanel/cpanelgo"
+import (
+	"context"
+
+	"github.com/letsencrypt-cpanel/cpanelgo"
+)
 
 type LocaleAPIResponse_UAPI struct {
 	cpanelgo.BaseUAPIResponse
@@ -13,8 +17,12 @@ type LocaleAPIResponse_UAPI struct {
 }
 
 func (c CpanelApi) GetLocaleAttributes() (LocaleAPIResponse_UAPI, error) {
+	return c.GetLocaleAttributesContext(context.Background())
+}
+
+func (c CpanelApi) GetLocaleAttributesContext(ctx context.Context) (LocaleAPIResponse_UAPI, error) {
 	var out LocaleAPIResponse_UAPI
-	err := c.Gateway.UAPI("Locale", "get_attributes", cpanelgo.Args{}, &out)
+	err := c.UAPIContext(ctx, "Locale", "get_attributes", cpanelgo.Args{}, &out)
 	if err == nil {
 		err = out.Error()
 	}
@@ -29,8 +37,12 @@ type LocaleAPIResponse_API2 struct {
 }
 
 func (c CpanelApi) GetUserLocale() (LocaleAPIResponse_API2, error) {
+	return c.GetUserLocaleContext(context.Background())
+}
+
+func (c CpanelApi) GetUserLocaleContext(ctx context.Context) (LocaleAPIResponse_API2, error) {
 	var out LocaleAPIResponse_API2
-	err := c.Gateway.API2("Locale", "get_user_locale", cpanelgo.Args{}, &out)
+	err := c.API2Context(ctx, "Locale", "get_user_locale", cpanelgo.Args{}, &out)
 	if err == nil {
 		err = out.Error()
 	}
@@ -1,6 +1,7 @@
 package cpanel
 
 import (
+	"context"
 	"encoding/json"
 
 	"github.com/letsencrypt-cpanel/cpanelgo"
@@ -15,8 +16,12 @@ type NVDataGetApiResult struct {
 }
 
 func (c CpanelApi) GetNVData(name string) (NVDataGetApiResult, error) {
+	return c.GetNVDataContext(context.Background(), name)
+}
+
+func (c CpanelApi) GetNVDataContext(ctx context.Context, name string) (NVDataGetApiResult, error) {
 	var out NVDataGetApiResult
-	err := c.Gateway.UAPI("NVData", "get", cpanelgo.Args{
+	err := c.UAPIContext(ctx, "NVData", "get", cpanelgo.Args{
 		"names": name,
 	}, &out)
 	if err == nil {
@@ -33,6 +38,10 @@ type NVDataSetApiResult struct {
 }
 
 func (c CpanelApi) SetNVData(name string, data interface{}) (NVDataSetApiResult, error) {
+	return c.SetNVDataContext(context.Background(), name, data)
+}
+
+func (c CpanelApi) SetNVDataContext(ctx context.Context, name string, data interface{}) (NVDataSetApiResult, error) {
 	var out NVDataSetApiResult
 
 	buf, err := json.Marshal(data)
@@ -40,7 +49,7 @@ func (c CpanelApi) SetNVData(name string, data interface{}) (NVDataSetApiResult,
 		return out, err
 	}
 
-	err = c.Gateway.UAPI("NVData", "set", cpanelgo.Args{
+	err = c.UAPIContext(ctx, "NVData", "set", cpanelgo.Args{
 		"names": name,
 		name:    string(buf),
 	}, &out)
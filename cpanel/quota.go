@@ -1,6 +1,7 @@
 package cpanel
 
 import (
+	"context"
 	"encoding/json"
 
 	"strconv"
@@ -41,8 +42,12 @@ func (q GetQuotaInfoApiResponse) IsUnderQuota() bool {
 }
 
 func (c CpanelApi) GetQuotaInfo() (GetQuotaInfoApiResponse, error) {
+	return c.GetQuotaInfoContext(context.Background())
+}
+
+func (c CpanelApi) GetQuotaInfoContext(ctx context.Context) (GetQuotaInfoApiResponse, error) {
 	var out GetQuotaInfoApiResponse
-	err := c.Gateway.UAPI("Quota", "get_quota_info", cpanelgo.Args{}, &out)
+	err := c.UAPIContext(ctx, "Quota", "get_quota_info", cpanelgo.Args{}, &out)
 	if err == nil {
 		err = out.Error()
 	}
@@ -1,6 +1,7 @@
 package cpanel
 
 import (
+	"context"
 	"strconv"
 	"strings"
 	"time"
@@ -40,8 +41,12 @@ type ListSSLKeysAPIResponse struct {
 }
 
 func (c CpanelApi) ListSSLKeys() (ListSSLKeysAPIResponse, error) {
+	return c.ListSSLKeysContext(context.Background())
+}
+
+func (c CpanelApi) ListSSLKeysContext(ctx context.Context) (ListSSLKeysAPIResponse, error) {
 	var out ListSSLKeysAPIResponse
-	err := c.Gateway.UAPI("SSL", "list_keys", nil, &out)
+	err := c.UAPIContext(ctx, "SSL", "list_keys", nil, &out)
 	if err == nil {
 		err = out.Error()
 	}
@@ -54,8 +59,12 @@ type ListSSLCertsAPIResponse struct {
 }
 
 func (c CpanelApi) ListSSLCerts() (ListSSLCertsAPIResponse, error) {
+	return c.ListSSLCertsContext(context.Background())
+}
+
+func (c CpanelApi) ListSSLCertsContext(ctx context.Context) (ListSSLCertsAPIResponse, error) {
 	var out ListSSLCertsAPIResponse
-	err := c.Gateway.UAPI("SSL", "list_certs", nil, &out)
+	err := c.UAPIContext(ctx, "SSL", "list_certs", nil, &out)
 	if err == nil {
 		err = out.Error()
 	}
@@ -195,19 +204,26 @@ func (r InstalledHostsApiResponse) DoesAnyValidCertificateOverlapVhostsWith(doma
 }
 
 func (c CpanelApi) InstalledHosts() (InstalledHostsApiResponse, error) {
+	return c.InstalledHostsContext(context.Background())
+}
+
+func (c CpanelApi) InstalledHostsContext(ctx context.Context) (InstalledHostsApiResponse, error) {
 	var out InstalledHostsApiResponse
 
-	if err := c.Gateway.UAPI("SSL", "installed_hosts", nil, &out); err != nil {
+	if err := c.UAPIContext(ctx, "SSL", "installed_hosts", nil, &out); err != nil {
 		return out, err
 	}
 
-	// If there is a non-transport error/warning and we didn't find any SSL
-	// virtual hosts, report this as a fatal error.
-	if err := out.Error(); err != nil && len(out.Data) == 0 {
-		return out, err
-	}
+	return out, out.fatalError()
+}
 
-	return out, nil
+// fatalError reports a non-transport error/warning as fatal only if we didn't find
+// any SSL virtual hosts.
+func (r InstalledHostsApiResponse) fatalError() error {
+	if err := r.Error(); err != nil && len(r.Data) == 0 {
+		return err
+	}
+	return nil
 }
 
 type GenerateSSLKeyAPIResponse struct {
@@ -223,8 +239,12 @@ type GenerateSSLKeyAPIResponse struct {
 }
 
 func (c CpanelApi) GenerateSSLKey(keySize int, friendlyName string) (GenerateSSLKeyAPIResponse, error) {
+	return c.GenerateSSLKeyContext(context.Background(), keySize, friendlyName)
+}
+
+func (c CpanelApi) GenerateSSLKeyContext(ctx context.Context, keySize int, friendlyName string) (GenerateSSLKeyAPIResponse, error) {
 	var out GenerateSSLKeyAPIResponse
-	err := c.Gateway.UAPI("SSL", "generate_key", cpanelgo.Args{
+	err := c.UAPIContext(ctx, "SSL", "generate_key", cpanelgo.Args{
 		"key_size":      strconv.Itoa(keySize),
 		"friendly_name": friendlyName,
 	}, &out)
@@ -253,8 +273,12 @@ type InstallSSLKeyAPIResponse struct {
 }
 
 func (c CpanelApi) InstallSSLKey(domain string, cert string, key string, cabundle string) (InstallSSLKeyAPIResponse, error) {
+	return c.InstallSSLKeyContext(context.Background(), domain, cert, key, cabundle)
+}
+
+func (c CpanelApi) InstallSSLKeyContext(ctx context.Context, domain string, cert string, key string, cabundle string) (InstallSSLKeyAPIResponse, error) {
 	var out InstallSSLKeyAPIResponse
-	err := c.Gateway.UAPI("SSL", "install_ssl", cpanelgo.Args{
+	err := c.UAPIContext(ctx, "SSL", "install_ssl", cpanelgo.Args{
 		"domain":   domain,
 		"cert":     cert,
 		"key":      key,
@@ -272,7 +296,8 @@ func (c CpanelApi) InstallSSLKey(domain string, cert string, key string, cabundl
 	// certificate is installed but no certid/keyid returned
 	// attempt to find the certid for installed status
 	// TODO: remove this prior to pushing to github
-	if err != nil && strings.Contains(err.Error(), "unknown error") {
+	var apiErr *cpanelgo.APIError
+	if errors.As(err, &apiErr) && apiErr.HasError("unknown error") {
 		// if the api actually returned the cert id proper, we can just ignore the error and continue
 		if out.Data.CertId != "" {
 			err = nil
@@ -280,7 +305,7 @@ func (c CpanelApi) InstallSSLKey(domain string, cert string, key string, cabundl
 			goto DORETURN
 		}
 		// otherwise try to find the installed certid of the given cert
-		installedCertId, findCertErr := c.findExistingCertificate(cert)
+		installedCertId, findCertErr := c.findExistingCertificate(ctx, cert)
 		if findCertErr != nil {
 			err = fmt.Errorf("Error checking installed ssl certificate: %v", findCertErr)
 			goto DORETURN
@@ -314,9 +339,9 @@ func decodeToCert(s string) (*x509.Certificate, error) {
 }
 
 // TODO: remove this prior to pushing to github
-func (c CpanelApi) findExistingCertificate(certPem string) (string, error) {
+func (c CpanelApi) findExistingCertificate(ctx context.Context, certPem string) (string, error) {
 
-	hosts, err := c.InstalledHosts()
+	hosts, err := c.InstalledHostsContext(ctx)
 	if err != nil {
 		return "", err
 	}
@@ -339,8 +364,12 @@ func (c CpanelApi) findExistingCertificate(certPem string) (string, error) {
 }
 
 func (c CpanelApi) DeleteSSL(domain string) (cpanelgo.BaseUAPIResponse, error) {
+	return c.DeleteSSLContext(context.Background(), domain)
+}
+
+func (c CpanelApi) DeleteSSLContext(ctx context.Context, domain string) (cpanelgo.BaseUAPIResponse, error) {
 	var out cpanelgo.BaseUAPIResponse
-	err := c.Gateway.UAPI("SSL", "delete_ssl", cpanelgo.Args{
+	err := c.UAPIContext(ctx, "SSL", "delete_ssl", cpanelgo.Args{
 		"domain": domain,
 	}, &out)
 	if err == nil {
@@ -350,8 +379,12 @@ func (c CpanelApi) DeleteSSL(domain string) (cpanelgo.BaseUAPIResponse, error) {
 }
 
 func (c CpanelApi) DeleteCert(certId string) (cpanelgo.BaseUAPIResponse, error) {
+	return c.DeleteCertContext(context.Background(), certId)
+}
+
+func (c CpanelApi) DeleteCertContext(ctx context.Context, certId string) (cpanelgo.BaseUAPIResponse, error) {
 	var out cpanelgo.BaseUAPIResponse
-	err := c.Gateway.UAPI("SSL", "delete_cert", cpanelgo.Args{
+	err := c.UAPIContext(ctx, "SSL", "delete_cert", cpanelgo.Args{
 		"id": certId,
 	}, &out)
 	if err == nil {
@@ -361,8 +394,12 @@ func (c CpanelApi) DeleteCert(certId string) (cpanelgo.BaseUAPIResponse, error)
 }
 
 func (c CpanelApi) DeleteKey(keyId string) (cpanelgo.BaseUAPIResponse, error) {
+	return c.DeleteKeyContext(context.Background(), keyId)
+}
+
+func (c CpanelApi) DeleteKeyContext(ctx context.Context, keyId string) (cpanelgo.BaseUAPIResponse, error) {
 	var out cpanelgo.BaseUAPIResponse
-	err := c.Gateway.UAPI("SSL", "delete_key", cpanelgo.Args{
+	err := c.UAPIContext(ctx, "SSL", "delete_key", cpanelgo.Args{
 		"id": keyId,
 	}, &out)
 	if err == nil {
@@ -380,8 +417,12 @@ type EnableMailSNIAPIResponse struct {
 }
 
 func (c CpanelApi) EnableMailSNI(domains ...string) (EnableMailSNIAPIResponse, error) {
+	return c.EnableMailSNIContext(context.Background(), domains...)
+}
+
+func (c CpanelApi) EnableMailSNIContext(ctx context.Context, domains ...string) (EnableMailSNIAPIResponse, error) {
 	var out EnableMailSNIAPIResponse
-	err := c.Gateway.UAPI("SSL", "enable_mail_sni", cpanelgo.Args{
+	err := c.UAPIContext(ctx, "SSL", "enable_mail_sni", cpanelgo.Args{
 		"domains": strings.Join(domains, "|"),
 	}, &out)
 	if err == nil {
@@ -396,8 +437,12 @@ type IsMailSNISupportedAPIResponse struct {
 }
 
 func (c CpanelApi) IsMailSNISupported() (IsMailSNISupportedAPIResponse, error) {
+	return c.IsMailSNISupportedContext(context.Background())
+}
+
+func (c CpanelApi) IsMailSNISupportedContext(ctx context.Context) (IsMailSNISupportedAPIResponse, error) {
 	var out IsMailSNISupportedAPIResponse
-	err := c.Gateway.UAPI("SSL", "is_mail_sni_supported", cpanelgo.Args{}, &out)
+	err := c.UAPIContext(ctx, "SSL", "is_mail_sni_supported", cpanelgo.Args{}, &out)
 	if err == nil {
 		err = out.Error()
 	}
@@ -412,8 +457,12 @@ type MailSNIStatusAPIResponse struct {
 }
 
 func (c CpanelApi) MailSNIStatus(domain string) (MailSNIStatusAPIResponse, error) {
+	return c.MailSNIStatusContext(context.Background(), domain)
+}
+
+func (c CpanelApi) MailSNIStatusContext(ctx context.Context, domain string) (MailSNIStatusAPIResponse, error) {
 	var out MailSNIStatusAPIResponse
-	err := c.Gateway.UAPI("SSL", "mail_sni_status", cpanelgo.Args{
+	err := c.UAPIContext(ctx, "SSL", "mail_sni_status", cpanelgo.Args{
 		"domain": domain,
 	}, &out)
 	if err == nil {
@@ -430,8 +479,12 @@ type RebuildMailSNIConfigAPIResponse struct {
 }
 
 func (c CpanelApi) RebuildMailSNIConfig() (RebuildMailSNIConfigAPIResponse, error) {
+	return c.RebuildMailSNIConfigContext(context.Background())
+}
+
+func (c CpanelApi) RebuildMailSNIConfigContext(ctx context.Context) (RebuildMailSNIConfigAPIResponse, error) {
 	var out RebuildMailSNIConfigAPIResponse
-	err := c.Gateway.UAPI("SSL", "rebuild_mail_sni_config", cpanelgo.Args{
+	err := c.UAPIContext(ctx, "SSL", "rebuild_mail_sni_config", cpanelgo.Args{
 		"reload_dovecot": 1,
 	}, &out)
 	if err == nil {
@@ -1,6 +1,10 @@
 package cpanel
 
-import "github.com/letsencrypt-cpanel/cpanelgo"
+import (
+	"context"
+
+	"github.com/letsencrypt-cpanel/cpanelgo"
+)
 
 type GetThemeAPIResponse struct {
 	cpanelgo.BaseUAPIResponse
@@ -8,8 +12,12 @@ type GetThemeAPIResponse struct {
 }
 
 func (c CpanelApi) GetTheme() (GetThemeAPIResponse, error) {
+	return c.GetThemeContext(context.Background())
+}
+
+func (c CpanelApi) GetThemeContext(ctx context.Context) (GetThemeAPIResponse, error) {
 	var out GetThemeAPIResponse
-	err := c.Gateway.UAPI("Themes", "get_theme_base", cpanelgo.Args{}, &out)
+	err := c.UAPIContext(ctx, "Themes", "get_theme_base", cpanelgo.Args{}, &out)
 	if err == nil {
 		err = out.Error()
 	}
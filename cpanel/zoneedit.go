@@ -1,6 +1,7 @@
 package cpanel
 
 import (
+	"context"
 	"errors"
 	"strings"
 
@@ -39,15 +40,19 @@ func (r FetchZoneApiResponse) Find(name, rrType string) (bool, []int) {
 }
 
 func (c CpanelApi) FetchZone(domain, types string) (FetchZoneApiResponse, error) {
+	return c.FetchZoneContext(context.Background(), domain, types)
+}
+
+func (c CpanelApi) FetchZoneContext(ctx context.Context, domain, types string) (FetchZoneApiResponse, error) {
 	var out FetchZoneApiResponse
 
-	err := c.Gateway.API2("ZoneEdit", "fetchzone", cpanelgo.Args{
+	err := c.API2Context(ctx, "ZoneEdit", "fetchzone", cpanelgo.Args{
 		"domain": domain,
 		"type":   types, // can be multiple CNAME,A,AAAA
 	}, &out)
 
-	if err == nil && out.Event.Result != 1 {
-		err = errors.New(out.Event.Reason)
+	if err == nil {
+		err = out.Error()
 	}
 
 	if err == nil && len(out.Data) > 0 && out.Data[0].Status != 1 {
@@ -68,9 +73,13 @@ type AddZoneTextRecordResponse struct {
 }
 
 func (c CpanelApi) AddZoneTextRecord(zone, name, txtData, ttl string) error {
+	return c.AddZoneTextRecordContext(context.Background(), zone, name, txtData, ttl)
+}
+
+func (c CpanelApi) AddZoneTextRecordContext(ctx context.Context, zone, name, txtData, ttl string) error {
 	var out AddZoneTextRecordResponse
 
-	err := c.Gateway.API2("ZoneEdit", "add_zone_record", cpanelgo.Args{
+	err := c.API2Context(ctx, "ZoneEdit", "add_zone_record", cpanelgo.Args{
 		"domain":  zone,
 		"name":    name,
 		"type":    "TXT",
@@ -78,8 +87,8 @@ func (c CpanelApi) AddZoneTextRecord(zone, name, txtData, ttl string) error {
 		"ttl":     ttl,
 	}, &out)
 
-	if err == nil && out.Event.Result != 1 {
-		err = errors.New(out.Event.Reason)
+	if err == nil {
+		err = out.Error()
 	}
 
 	if err == nil && len(out.Data) > 0 && out.Data[0].Result.Status != 1 {
@@ -100,9 +109,13 @@ type EditZoneTextRecordResponse struct {
 }
 
 func (c CpanelApi) EditZoneTextRecord(line int, zone, txtData, ttl string) error {
+	return c.EditZoneTextRecordContext(context.Background(), line, zone, txtData, ttl)
+}
+
+func (c CpanelApi) EditZoneTextRecordContext(ctx context.Context, line int, zone, txtData, ttl string) error {
 	var out EditZoneTextRecordResponse
 
-	err := c.Gateway.API2("ZoneEdit", "edit_zone_record", cpanelgo.Args{
+	err := c.API2Context(ctx, "ZoneEdit", "edit_zone_record", cpanelgo.Args{
 		"domain":  zone,
 		"type":    "TXT",
 		"txtdata": txtData,
@@ -110,8 +123,8 @@ func (c CpanelApi) EditZoneTextRecord(line int, zone, txtData, ttl string) error
 		"ttl":     ttl,
 	}, &out)
 
-	if err == nil && out.Event.Result != 1 {
-		err = errors.New(out.Event.Reason)
+	if err == nil {
+		err = out.Error()
 	}
 
 	if err == nil && len(out.Data) > 0 && out.Data[0].Result.Status != 1 {
@@ -152,12 +165,16 @@ func (r FetchZonesApiResponse) FindRootForName(name string) string {
 }
 
 func (c CpanelApi) FetchZones() (FetchZonesApiResponse, error) {
+	return c.FetchZonesContext(context.Background())
+}
+
+func (c CpanelApi) FetchZonesContext(ctx context.Context) (FetchZonesApiResponse, error) {
 	var out FetchZonesApiResponse
 
-	err := c.Gateway.API2("ZoneEdit", "fetchzones", cpanelgo.Args{}, &out)
+	err := c.API2Context(ctx, "ZoneEdit", "fetchzones", cpanelgo.Args{}, &out)
 
-	if err == nil && out.Event.Result != 1 {
-		err = errors.New(out.Event.Reason)
+	if err == nil {
+		err = out.Error()
 	}
 
 	if err == nil && len(out.Data) > 0 && out.Data[0].Status != 1 {
@@ -1,11 +1,13 @@
 package cpanelgo
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"net/url"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -33,13 +35,28 @@ func init() {
 
 type BaseResult struct {
 	ErrorString string `json:"error"`
+	// a pointer, so that the response types stay comparable
+	info *ResponseInfo
+}
+
+func (r *BaseResult) setResponseInfo(info ResponseInfo) {
+	r.info = &info
+}
+
+// ResponseInfo describes the call which produced the response, it is the zero
+// ResponseInfo if the response was not returned by a gateway.
+func (r BaseResult) ResponseInfo() ResponseInfo {
+	if r.info == nil {
+		return ResponseInfo{}
+	}
+	return *r.info
 }
 
 func (r BaseResult) Error() error {
 	if r.ErrorString == "" {
 		return nil
 	}
-	return errors.New(r.ErrorString)
+	return r.ResponseInfo().NewAPIError([]string{r.ErrorString}, nil, nil)
 }
 
 type UAPIResult struct {
@@ -54,9 +71,37 @@ type API2Result struct {
 
 type BaseUAPIResponse struct {
 	BaseResult
-	StatusCode int      `json:"status"`
-	Errors     []string `json:"errors"`
-	Messages   []string `json:"messages"`
+	StatusCode int          `json:"status"`
+	Errors     []string     `json:"errors"`
+	Messages   []string     `json:"messages"`
+	Warnings   []string     `json:"warnings"`
+	Metadata   UAPIMetadata `json:"metadata"`
+}
+
+// UAPIMetadata is the metadata of a UAPI response.
+type UAPIMetadata struct {
+	// Set when the results were paginated, see Query
+	Paginate *Pagination `json:"paginate"`
+	// 1 when the results were sorted, filtered or had their columns selected
+	Transformed int `json:"transformed"`
+	// The complete metadata, to which some functions add their own fields
+	Raw json.RawMessage `json:"-"`
+}
+
+func (m *UAPIMetadata) UnmarshalJSON(buf []byte) error {
+	type plain UAPIMetadata
+	var p plain
+	// empty metadata may come as [] from cPanel's JSON encoder
+	if trimmed := bytes.TrimSpace(buf); !bytes.HasPrefix(trimmed, []byte("[")) {
+		if err := json.Unmarshal(buf, &p); err != nil {
+			return err
+		}
+	}
+	*m = UAPIMetadata(p)
+	if string(buf) != "null" {
+		m.Raw = append(json.RawMessage(nil), buf...)
+	}
+	return nil
 }
 
 func (r BaseUAPIResponse) Error() error {
@@ -66,10 +111,38 @@ func (r BaseUAPIResponse) Error() error {
 	if err := r.BaseResult.Error(); err != nil {
 		return err
 	}
-	if len(r.Errors) == 0 {
-		return errors.New(ErrorUnknown)
+	return r.ResponseInfo().NewAPIError(r.Errors, r.Messages, r.Warnings)
+}
+
+// Pagination returns which page of the results the response holds, if the call
+// asked for pagination.
+func (r BaseUAPIResponse) Pagination() (Pagination, bool) {
+	if r.Metadata.Paginate == nil {
+		return Pagination{}, false
 	}
-	return errors.New(strings.Join(r.Errors, "\n"))
+	return *r.Metadata.Paginate, true
+}
+
+// AllWarnings returns the warnings of the response, including those reported
+// alongside it, such as by LiveAPI.
+func (r BaseUAPIResponse) AllWarnings() []string {
+	extra := r.ResponseInfo().Warnings
+	if len(extra) == 0 {
+		return r.Warnings
+	}
+	return append(append([]string(nil), r.Warnings...), extra...)
+}
+
+// HasWarnings reports whether the call raised warnings, whether or not it
+// succeeded.
+func (r BaseUAPIResponse) HasWarnings() bool {
+	return len(r.Warnings) > 0 || len(r.ResponseInfo().Warnings) > 0
+}
+
+// SucceededWithWarnings reports whether the call succeeded but raised warnings,
+// unlike a clean success.
+func (r BaseUAPIResponse) SucceededWithWarnings() bool {
+	return r.StatusCode == 1 && r.HasWarnings()
 }
 
 func (r BaseUAPIResponse) Message() string {
@@ -96,9 +169,9 @@ func (r BaseAPI2Response) Error() error {
 		return err
 	}
 	if len(r.Event.Reason) == 0 {
-		return errors.New("Unknown")
+		return r.ResponseInfo().NewAPIError(nil, nil, nil)
 	}
-	return errors.New(r.Event.Reason)
+	return r.ResponseInfo().NewAPIError([]string{r.Event.Reason}, nil, nil)
 }
 
 type BaseAPI1Response struct {
@@ -112,41 +185,73 @@ type BaseAPI1Response struct {
 		Result int    `json:"result"`
 		Reason string `json:"reason"`
 	} `json:"event"`
+	info *ResponseInfo
+}
+
+func (r *BaseAPI1Response) setResponseInfo(info ResponseInfo) {
+	r.info = &info
+}
+
+// ResponseInfo describes the call which produced the response, it is the zero
+// ResponseInfo if the response was not returned by a gateway.
+func (r BaseAPI1Response) ResponseInfo() ResponseInfo {
+	if r.info == nil {
+		return ResponseInfo{}
+	}
+	return *r.info
 }
 
 func (r BaseAPI1Response) Error() error {
 	if r.ErrorString != "" {
-		return errors.New(r.ErrorString)
+		return r.ResponseInfo().NewAPIError([]string{r.ErrorString}, nil, nil)
 	}
 	if r.Event.Result != 1 {
 		// if the result != 1 the reason usually present in error ^ so kinda redundant to check, but check just in case
 		if len(r.Event.Reason) == 0 {
-			return errors.New("Unknown")
+			return r.ResponseInfo().NewAPIError(nil, nil, nil)
 		}
-		return errors.New(r.Event.Reason)
+		return r.ResponseInfo().NewAPIError([]string{r.Event.Reason}, nil, nil)
 	}
 	return nil
 }
 
 type Args map[string]interface{}
 
-func (a Args) Values(apiVersion string) url.Values {
-	vals := url.Values{}
-	for k, v := range a {
-		if apiVersion == "1" {
-			kv := strings.SplitN(k, "=", 2)
-			if len(kv) == 1 {
-				vals.Add(kv[0], "")
-			} else if len(kv) == 2 {
-				vals.Add(kv[0], kv[1])
-			}
+// Params encodes the arguments as EncodeArgs does, failing with the first argument
+// which cannot be encoded. For API 1 the names are taken as "name=value" pairs
+// instead, sorted, a form from before positional arguments were sent as arg-0,
+// arg-1, ...
+func (a Args) Params(apiVersion string) (Params, error) {
+	if apiVersion != "1" {
+		return EncodeArgs(a, nil)
+	}
+	names := make([]string, 0, len(a))
+	for k := range a {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var p Params
+	for _, k := range names {
+		kv := strings.SplitN(k, "=", 2)
+		if len(kv) == 1 {
+			p = append(p, Param{Name: kv[0]})
 		} else {
-			vals.Add(k, fmt.Sprintf("%v", v))
+			p = append(p, Param{Name: kv[0], Value: kv[1]})
 		}
 	}
-	return vals
+	return p, nil
+}
+
+// Values encodes the arguments as Params does.
+//
+// Deprecated: an argument which cannot be encoded is sent formatted with %v instead
+// of failing, use Params which reports it.
+func (a Args) Values(apiVersion string) url.Values {
+	p, _ := a.Params(apiVersion)
+	return p.Values()
 }
 
+// ApiGateway is implemented by every transport capable of calling the cPanel API.
 type ApiGateway interface {
 	UAPI(module, function string, arguments Args, out interface{}) error
 	API2(module, function string, arguments Args, out interface{}) error
@@ -154,6 +259,50 @@ type ApiGateway interface {
 	Close() error
 }
 
+// ContextGateway is implemented by the gateways which honour cancellation and
+// deadlines of ctx, as all the gateways of this module do. The plain variants are
+// equivalent to calling them with context.Background().
+type ContextGateway interface {
+	ApiGateway
+	UAPIContext(ctx context.Context, module, function string, arguments Args, out interface{}) error
+	API2Context(ctx context.Context, module, function string, arguments Args, out interface{}) error
+	API1Context(ctx context.Context, module, function string, arguments []string, out interface{}) error
+}
+
+// AsContextGateway returns gw if it is a ContextGateway, or else wraps it so that
+// ctx is only checked before each call.
+func AsContextGateway(gw ApiGateway) ContextGateway {
+	if cgw, ok := gw.(ContextGateway); ok {
+		return cgw
+	}
+	return contextGateway{gw}
+}
+
+type contextGateway struct {
+	ApiGateway
+}
+
+func (g contextGateway) UAPIContext(ctx context.Context, module, function string, arguments Args, out interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return g.UAPI(module, function, arguments, out)
+}
+
+func (g contextGateway) API2Context(ctx context.Context, module, function string, arguments Args, out interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return g.API2(module, function, arguments, out)
+}
+
+func (g contextGateway) API1Context(ctx context.Context, module, function string, arguments []string, out interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return g.API1(module, function, arguments, out)
+}
+
 type Api struct {
 	Gateway ApiGateway
 }
@@ -164,6 +313,42 @@ func NewApi(gw ApiGateway) Api {
 	}
 }
 
+// UAPIContext calls a UAPI function through the gateway, honouring ctx as far as the
+// gateway does.
+func (a Api) UAPIContext(ctx context.Context, module, function string, arguments Args, out interface{}) error {
+	return AsContextGateway(a.Gateway).UAPIContext(ctx, module, function, arguments, out)
+}
+
+// API2Context calls an API2 function through the gateway, honouring ctx as far as
+// the gateway does.
+func (a Api) API2Context(ctx context.Context, module, function string, arguments Args, out interface{}) error {
+	return AsContextGateway(a.Gateway).API2Context(ctx, module, function, arguments, out)
+}
+
+// API1Context calls an API1 function through the gateway, honouring ctx as far as
+// the gateway does.
+func (a Api) API1Context(ctx context.Context, module, function string, arguments []string, out interface{}) error {
+	return AsContextGateway(a.Gateway).API1Context(ctx, module, function, arguments, out)
+}
+
+// UAPIQuery calls a UAPI function with the parameters of q added to arguments.
+func (a Api) UAPIQuery(module, function string, arguments Args, q Query, out interface{}) error {
+	return a.UAPIQueryContext(context.Background(), module, function, arguments, q, out)
+}
+
+func (a Api) UAPIQueryContext(ctx context.Context, module, function string, arguments Args, q Query, out interface{}) error {
+	return a.UAPIContext(ctx, module, function, q.Args("uapi", arguments), out)
+}
+
+// API2Query calls an API2 function with the parameters of q added to arguments.
+func (a Api) API2Query(module, function string, arguments Args, q Query, out interface{}) error {
+	return a.API2QueryContext(context.Background(), module, function, arguments, q, out)
+}
+
+func (a Api) API2QueryContext(ctx context.Context, module, function string, arguments Args, q Query, out interface{}) error {
+	return a.API2Context(ctx, module, function, q.Args("2", arguments), out)
+}
+
 func (a Api) Close() error {
 	if a.Gateway != nil {
 		return a.Gateway.Close()
@@ -207,11 +392,48 @@ func (m *MaybeInt64) UnmarshalJSON(buf []byte) error {
 	return nil
 }
 
+// MaybeStrings is a list of strings, which the API may also return as a single
+// string or null.
+type MaybeStrings []string
+
+func (m *MaybeStrings) UnmarshalJSON(buf []byte) error {
+	var out interface{}
+	if err := json.Unmarshal(buf, &out); err != nil {
+		return err
+	}
+
+	switch v := out.(type) {
+	case nil:
+		*m = nil
+	case string:
+		if v == "" {
+			*m = nil
+			break
+		}
+		*m = MaybeStrings{v}
+	case []interface{}:
+		*m = make(MaybeStrings, 0, len(v))
+		for _, vv := range v {
+			s, ok := vv.(string)
+			if !ok {
+				return errors.New("Not a string or list of strings")
+			}
+			*m = append(*m, s)
+		}
+	default:
+		return errors.New("Not a string or list of strings")
+	}
+
+	return nil
+}
+
 /*
 	"subject.commonName" : {
 	  "commonName" : "mail.l33t.website"
 	},
+
 or
+
 	"subject.commonName" : "mail.l33t.website",
 */
 type MaybeCommonNameString string
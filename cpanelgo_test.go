@@ -1,6 +1,8 @@
 package cpanelgo
 
 import (
+	"context"
+	"encoding/json"
 	"net/url"
 	"reflect"
 	"testing"
@@ -25,3 +27,89 @@ func TestArgs_Values(t *testing.T) {
 		t.Errorf("Unexpected Args.Values(), expected: '%+v', got: '%+v'", expected0, actual0)
 	}
 }
+
+// plainGateway implements only ApiGateway, as gateways written outside this module may
+type plainGateway struct {
+	calls int
+}
+
+func (g *plainGateway) UAPI(module, function string, arguments Args, out interface{}) error {
+	g.calls++
+	return nil
+}
+func (g *plainGateway) API2(module, function string, arguments Args, out interface{}) error {
+	g.calls++
+	return nil
+}
+func (g *plainGateway) API1(module, function string, arguments []string, out interface{}) error {
+	g.calls++
+	return nil
+}
+func (g *plainGateway) Close() error {
+	return nil
+}
+
+func TestAsContextGateway(t *testing.T) {
+	gw := &plainGateway{}
+	api := NewApi(gw)
+	if err := api.UAPIContext(context.Background(), "Mod", "func", nil, nil); err != nil || gw.calls != 1 {
+		t.Errorf("plain gateway not called: %d, %v", gw.calls, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := api.API2Context(ctx, "Mod", "func", nil, nil); err != context.Canceled || gw.calls != 1 {
+		t.Errorf("plain gateway called with a cancelled context: %d, %v", gw.calls, err)
+	}
+
+	retrying := NewRetryingGateway(gw, RetryPolicy{})
+	if AsContextGateway(retrying) != retrying {
+		t.Error("context gateway wrapped")
+	}
+}
+
+func TestBaseUAPIResponseWarnings(t *testing.T) {
+	var out BaseUAPIResponse
+	body := `{"status":1,"errors":null,"messages":null,"warnings":["Quota is almost full"],"metadata":{"transformed":1,"records":3}}`
+	if err := json.Unmarshal([]byte(body), &out); err != nil {
+		t.Fatal(err)
+	}
+	SetResponseInfo(&out, ResponseInfo{APIVersion: "uapi", Warnings: []string{"A warning occurred while processing this directive."}})
+
+	if out.Error() != nil || !out.HasWarnings() || !out.SucceededWithWarnings() {
+		t.Errorf("expected success with warnings: %+v", out)
+	}
+	if warnings := out.AllWarnings(); len(warnings) != 2 || warnings[0] != "Quota is almost full" {
+		t.Errorf("unexpected warnings: %q", warnings)
+	}
+	if out.Metadata.Transformed != 1 || string(out.Metadata.Raw) != `{"transformed":1,"records":3}` {
+		t.Errorf("unexpected metadata: %+v", out.Metadata)
+	}
+
+	var clean BaseUAPIResponse
+	if err := json.Unmarshal([]byte(`{"status":1,"metadata":[]}`), &clean); err != nil {
+		t.Fatal(err)
+	}
+	if clean.HasWarnings() || clean.SucceededWithWarnings() {
+		t.Errorf("expected a clean success: %+v", clean)
+	}
+}
+
+func TestMaybeStrings(t *testing.T) {
+	tests := map[string]MaybeStrings{
+		`null`:          nil,
+		`""`:            nil,
+		`"one"`:         {"one"},
+		`["one","two"]`: {"one", "two"},
+	}
+	for input, expected := range tests {
+		var out MaybeStrings
+		if err := json.Unmarshal([]byte(input), &out); err != nil || !reflect.DeepEqual(out, expected) {
+			t.Errorf("%s: unexpected %q, %v", input, out, err)
+		}
+	}
+	var out MaybeStrings
+	if err := json.Unmarshal([]byte(`[1]`), &out); err == nil {
+		t.Error("expected an error for a list of numbers")
+	}
+}
@@ -0,0 +1,301 @@
+package cpaneltest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sync"
+
+	"github.com/letsencrypt-cpanel/cpanelgo"
+	"github.com/letsencrypt-cpanel/cpanelgo/whm"
+)
+
+// Interaction is a call and the response it received, as stored in a cassette.
+// Arguments and response are redacted.
+type Interaction struct {
+	APIVersion     string          `json:"api_version"`
+	Module         string          `json:"module,omitempty"`
+	Function       string          `json:"function"`
+	Args           cpanelgo.Args   `json:"args,omitempty"`
+	PositionalArgs []string        `json:"positional_args,omitempty"`
+	Response       json.RawMessage `json:"response,omitempty"`
+	// Set when the call failed, StatusCode and Errors only for API errors
+	Error      string   `json:"error,omitempty"`
+	StatusCode int      `json:"status_code,omitempty"`
+	Errors     []string `json:"errors,omitempty"`
+}
+
+// Cassette is a recording of calls to a real server, which can be replayed offline
+// to turn the quirks of real responses into regression tests.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+func LoadCassette(path string) (*Cassette, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Cassette
+	if err := json.Unmarshal(buf, &c); err != nil {
+		return nil, fmt.Errorf("cassette %s: %v", path, err)
+	}
+	return &c, nil
+}
+
+func (c *Cassette) Save(path string) error {
+	buf, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(buf, '\n'), 0600)
+}
+
+// Recorder records the calls made through a gateway and their responses, with
+// secrets redacted (see cpanelgo.SensitiveKeys). Either wrap a gateway with
+// Gateway, or add Intercept to the interceptors of a gateway or WhmApi.
+type Recorder struct {
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Intercept is a cpanelgo.Interceptor which records the call it passes on. A response
+// is recorded and decoded into out even when the call failed, as the results of a
+// failed batch are.
+func (r *Recorder) Intercept(ctx context.Context, call *cpanelgo.Call, out interface{}, next cpanelgo.Invoker) error {
+	var raw json.RawMessage
+	err := next(ctx, call, &raw)
+
+	i := Interaction{
+		APIVersion:     call.APIVersion,
+		Module:         call.Module,
+		Function:       call.Function,
+		Args:           cpanelgo.RedactArgs(call.Args),
+		PositionalArgs: cpanelgo.RedactPositionalArgs(call.PositionalArgs),
+	}
+	if err != nil {
+		i.Error = err.Error()
+		var apiErr *cpanelgo.APIError
+		if errors.As(err, &apiErr) {
+			i.StatusCode = apiErr.StatusCode
+			i.Errors = apiErr.Errors
+		}
+	}
+	if len(raw) > 0 {
+		i.Response = cpanelgo.RedactJSON(raw)
+	}
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, i)
+	r.mu.Unlock()
+
+	if out == nil || len(raw) == 0 {
+		return err
+	}
+	if decodeErr := json.Unmarshal(raw, out); decodeErr != nil {
+		if err != nil {
+			return err
+		}
+		return decodeErr
+	}
+	statusCode := i.StatusCode
+	if statusCode == 0 {
+		statusCode = 200
+	}
+	whm.SetResponseInfo(out, cpanelgo.ResponseInfo{
+		APIVersion: call.APIVersion,
+		Module:     call.Module,
+		Function:   call.Function,
+		StatusCode: statusCode,
+		Body:       raw,
+	})
+	return err
+}
+
+// Cassette returns a copy of what was recorded so far.
+func (r *Recorder) Cassette() *Cassette {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return &Cassette{Interactions: append([]Interaction(nil), r.cassette.Interactions...)}
+}
+
+// Save writes what was recorded so far to path.
+func (r *Recorder) Save(path string) error {
+	return r.Cassette().Save(path)
+}
+
+// Gateway wraps gw, recording every call made through it.
+func (r *Recorder) Gateway(gw cpanelgo.ApiGateway) cpanelgo.ApiGateway {
+	return &recordingGateway{gw: gw, r: r}
+}
+
+type recordingGateway struct {
+	gw cpanelgo.ApiGateway
+	r  *Recorder
+}
+
+func (g *recordingGateway) invoke(ctx context.Context, call *cpanelgo.Call, out interface{}) error {
+	switch call.APIVersion {
+	case UAPI:
+		return cpanelgo.AsContextGateway(g.gw).UAPIContext(ctx, call.Module, call.Function, call.Args, out)
+	case API2:
+		return cpanelgo.AsContextGateway(g.gw).API2Context(ctx, call.Module, call.Function, call.Args, out)
+	default:
+		return cpanelgo.AsContextGateway(g.gw).API1Context(ctx, call.Module, call.Function, call.PositionalArgs, out)
+	}
+}
+
+func (g *recordingGateway) UAPI(module, function string, arguments cpanelgo.Args, out interface{}) error {
+	return g.UAPIContext(context.Background(), module, function, arguments, out)
+}
+
+func (g *recordingGateway) UAPIContext(ctx context.Context, module, function string, arguments cpanelgo.Args, out interface{}) error {
+	return g.r.Intercept(ctx, &cpanelgo.Call{
+		APIVersion: UAPI,
+		Module:     module,
+		Function:   function,
+		Args:       arguments,
+	}, out, g.invoke)
+}
+
+func (g *recordingGateway) API2(module, function string, arguments cpanelgo.Args, out interface{}) error {
+	return g.API2Context(context.Background(), module, function, arguments, out)
+}
+
+func (g *recordingGateway) API2Context(ctx context.Context, module, function string, arguments cpanelgo.Args, out interface{}) error {
+	return g.r.Intercept(ctx, &cpanelgo.Call{
+		APIVersion: API2,
+		Module:     module,
+		Function:   function,
+		Args:       arguments,
+	}, out, g.invoke)
+}
+
+func (g *recordingGateway) API1(module, function string, arguments []string, out interface{}) error {
+	return g.API1Context(context.Background(), module, function, arguments, out)
+}
+
+func (g *recordingGateway) API1Context(ctx context.Context, module, function string, arguments []string, out interface{}) error {
+	return g.r.Intercept(ctx, &cpanelgo.Call{
+		APIVersion:     API1,
+		Module:         module,
+		Function:       function,
+		PositionalArgs: arguments,
+	}, out, g.invoke)
+}
+
+func (g *recordingGateway) Close() error {
+	return g.gw.Close()
+}
+
+// Replay returns a fake which answers calls with the interactions of c. A call is
+// answered by the interactions recorded with the same (redacted) arguments, in the
+// order they were recorded, repeating the last one once they are used up. Use
+// Fake.CpanelApi or Fake.WhmApi to replay calls of the respective API.
+func Replay(c *Cassette) *Fake {
+	f := NewFake()
+
+	byKey := map[string][]Interaction{}
+	for _, i := range c.Interactions {
+		k := key(i.APIVersion, i.Module, i.Function)
+		byKey[k] = append(byKey[k], i)
+	}
+
+	for _, interactions := range byKey {
+		i := interactions[0]
+		f.Handle(i.APIVersion, i.Module, i.Function, newReplayer(interactions).handle)
+	}
+	return f
+}
+
+// ReplayFile replays the cassette stored at path, see Replay.
+func ReplayFile(path string) (*Fake, error) {
+	c, err := LoadCassette(path)
+	if err != nil {
+		return nil, err
+	}
+	return Replay(c), nil
+}
+
+type replayer struct {
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+}
+
+func newReplayer(interactions []Interaction) *replayer {
+	return &replayer{
+		interactions: interactions,
+		used:         make([]bool, len(interactions)),
+	}
+}
+
+func (r *replayer) handle(call *cpanelgo.Call) (interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	args := normalizeArgs(call.Args)
+	positional := cpanelgo.RedactPositionalArgs(call.PositionalArgs)
+
+	last := -1
+	for n, i := range r.interactions {
+		if normalizeArgs(i.Args) != args || !equalStrings(i.PositionalArgs, positional) {
+			continue
+		}
+		last = n
+		if !r.used[n] {
+			break
+		}
+	}
+	if last < 0 {
+		return nil, fmt.Errorf("%w: %s %s with these arguments", ErrNoResponse, call.APIVersion, callName(call))
+	}
+	r.used[last] = true
+
+	i := r.interactions[last]
+	var response interface{}
+	if i.Response != nil {
+		response = i.Response
+	}
+	if i.StatusCode != 0 || len(i.Errors) > 0 {
+		return response, &cpanelgo.APIError{
+			APIVersion: i.APIVersion,
+			Module:     i.Module,
+			Function:   i.Function,
+			StatusCode: i.StatusCode,
+			Errors:     i.Errors,
+		}
+	}
+	if i.Error != "" {
+		return response, errors.New(i.Error)
+	}
+	if response == nil {
+		return json.RawMessage("null"), nil
+	}
+	return response, nil
+}
+
+// normalizeArgs makes arguments comparable with recorded ones, whose values went
+// through redaction and JSON
+func normalizeArgs(args cpanelgo.Args) string {
+	if len(args) == 0 {
+		return ""
+	}
+	buf, _ := json.Marshal(cpanelgo.RedactArgs(args))
+	return string(buf)
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,298 @@
+// Package cpaneltest provides an in-memory fake of the cPanel and WHM APIs for
+// testing code built on cpanel.CpanelApi and whm.WhmApi.
+//
+//	fake := cpaneltest.NewFake().
+//		Respond(cpaneltest.UAPI, "SSL", "installed_hosts", cpaneltest.InstalledHosts()).
+//		Fail(cpaneltest.UAPI, "SSL", "install_ssl", errors.New("boom"))
+//	api := fake.CpanelApi()
+//	...
+//	calls := fake.CallsTo(cpaneltest.UAPI, "SSL", "install_ssl")
+package cpaneltest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/letsencrypt-cpanel/cpanelgo"
+	"github.com/letsencrypt-cpanel/cpanelgo/cpanel"
+	"github.com/letsencrypt-cpanel/cpanelgo/whm"
+)
+
+// API versions, as found in cpanelgo.Call.APIVersion
+const (
+	UAPI    = "uapi"
+	API2    = "2"
+	API1    = "1"
+	WHMAPI1 = "whmapi1"
+)
+
+// ErrNoResponse is returned for calls the fake has no response for
+var ErrNoResponse = errors.New("no response for call")
+
+// Handler computes the response to a call. The returned value is decoded into the
+// output of the call like any response passed to Fake.Respond, even along with an
+// error, as the results of a failed batch are.
+type Handler func(call *cpanelgo.Call) (interface{}, error)
+
+// Fake is an in-memory cpanelgo.ApiGateway. Responses are keyed by API version,
+// module and function, and every call it receives is recorded. WHM API 1 calls
+// have an empty module. It is safe for concurrent use.
+type Fake struct {
+	mu       sync.Mutex
+	handlers map[string]Handler
+	calls    []cpanelgo.Call
+}
+
+// NewFake returns a fake without responses, except for UAPI Batch::strict which runs
+// the calls of the batch against the fake, stopping at the first whose status is
+// not 1 as cPanel does.
+func NewFake() *Fake {
+	f := &Fake{
+		handlers: map[string]Handler{},
+	}
+	f.handlers[key(UAPI, "Batch", "strict")] = f.batch
+	return f
+}
+
+func key(apiVersion, module, function string) string {
+	return apiVersion + "/" + module + "/" + function
+}
+
+// Handle makes h compute the responses to calls of module::function.
+func (f *Fake) Handle(apiVersion, module, function string, h Handler) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.handlers[key(apiVersion, module, function)] = h
+	return f
+}
+
+// Respond makes calls of module::function return response, which may be raw JSON
+// as a string, []byte or json.RawMessage, or any value that marshals to JSON. For
+// UAPI and WHM API 1 calls it is the whole response, for API2 and API1 calls the
+// content of "cpanelresult".
+func (f *Fake) Respond(apiVersion, module, function string, response interface{}) *Fake {
+	return f.Handle(apiVersion, module, function, func(*cpanelgo.Call) (interface{}, error) {
+		return response, nil
+	})
+}
+
+// Fail makes calls of module::function fail with err, as if the request had not
+// reached the server.
+func (f *Fake) Fail(apiVersion, module, function string, err error) *Fake {
+	return f.Handle(apiVersion, module, function, func(*cpanelgo.Call) (interface{}, error) {
+		return nil, err
+	})
+}
+
+// Calls returns the calls received so far, oldest first.
+func (f *Fake) Calls() []cpanelgo.Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]cpanelgo.Call(nil), f.calls...)
+}
+
+// CallsTo returns the calls of module::function received so far, oldest first.
+func (f *Fake) CallsTo(apiVersion, module, function string) []cpanelgo.Call {
+	var calls []cpanelgo.Call
+	for _, c := range f.Calls() {
+		if c.APIVersion == apiVersion && c.Module == module && c.Function == function {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// Reset forgets the recorded calls, but keeps the responses.
+func (f *Fake) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = nil
+}
+
+// Invoke records call and decodes the response for it into out. It is a
+// cpanelgo.Invoker, so it can also terminate the interceptors of real gateways.
+func (f *Fake) Invoke(ctx context.Context, call *cpanelgo.Call, out interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	recorded := *call
+	if call.Args != nil {
+		recorded.Args = cpanelgo.Args{}
+		for k, v := range call.Args {
+			recorded.Args[k] = v
+		}
+	}
+	recorded.PositionalArgs = append([]string(nil), call.PositionalArgs...)
+
+	f.mu.Lock()
+	f.calls = append(f.calls, recorded)
+	h, ok := f.handlers[key(call.APIVersion, call.Module, call.Function)]
+	f.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("%w: %s %s", ErrNoResponse, call.APIVersion, callName(call))
+	}
+
+	response, err := h(&recorded)
+	if response == nil && err != nil {
+		return err
+	}
+
+	var body []byte
+	switch v := response.(type) {
+	case string:
+		body = []byte(v)
+	case []byte:
+		body = v
+	case json.RawMessage:
+		body = v
+	default:
+		var marshalErr error
+		if body, marshalErr = json.Marshal(v); marshalErr != nil {
+			return marshalErr
+		}
+	}
+	call.ResponseSize = int64(len(body))
+
+	if out == nil {
+		return err
+	}
+	if decodeErr := json.Unmarshal(body, out); decodeErr != nil {
+		if err != nil {
+			return err
+		}
+		return decodeErr
+	}
+	whm.SetResponseInfo(out, cpanelgo.ResponseInfo{
+		APIVersion: call.APIVersion,
+		Module:     call.Module,
+		Function:   call.Function,
+		StatusCode: 200,
+		Body:       body,
+	})
+	return err
+}
+
+// batch answers Batch::strict, whose command arguments are JSON arrays of the form
+// ["Module", "function", {"name": "value", ...}]
+func (f *Fake) batch(call *cpanelgo.Call) (interface{}, error) {
+	var commands []string
+	switch v := call.Args["command"].(type) {
+	case string:
+		commands = []string{v}
+	case []string:
+		commands = v
+	case []interface{}:
+		for _, c := range v {
+			commands = append(commands, fmt.Sprint(c))
+		}
+	}
+
+	results := []json.RawMessage{}
+	for _, command := range commands {
+		var cmd []json.RawMessage
+		if err := json.Unmarshal([]byte(command), &cmd); err != nil || len(cmd) < 2 {
+			return UAPIError("Invalid batch command: " + command), nil
+		}
+		sub := &cpanelgo.Call{APIVersion: UAPI}
+		json.Unmarshal(cmd[0], &sub.Module)
+		json.Unmarshal(cmd[1], &sub.Function)
+		if len(cmd) > 2 {
+			json.Unmarshal(cmd[2], &sub.Args)
+		}
+
+		var result json.RawMessage
+		if err := f.Invoke(context.Background(), sub, &result); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+
+		var status struct {
+			Status int `json:"status"`
+		}
+		if json.Unmarshal(result, &status); status.Status != 1 {
+			failed := UAPIError(callName(sub) + " failed").(map[string]interface{})
+			failed["data"] = results
+			return failed, nil
+		}
+	}
+	return UAPIResult(results), nil
+}
+
+func callName(call *cpanelgo.Call) string {
+	if call.Module == "" {
+		return call.Function
+	}
+	return call.Module + "::" + call.Function
+}
+
+// Intercept is a cpanelgo.Interceptor which answers every call from the fake
+// instead of passing it on.
+func (f *Fake) Intercept(ctx context.Context, call *cpanelgo.Call, out interface{}, _ cpanelgo.Invoker) error {
+	return f.Invoke(ctx, call, out)
+}
+
+func (f *Fake) UAPI(module, function string, arguments cpanelgo.Args, out interface{}) error {
+	return f.UAPIContext(context.Background(), module, function, arguments, out)
+}
+
+func (f *Fake) UAPIContext(ctx context.Context, module, function string, arguments cpanelgo.Args, out interface{}) error {
+	return f.Invoke(ctx, &cpanelgo.Call{
+		APIVersion: UAPI,
+		Module:     module,
+		Function:   function,
+		Args:       arguments,
+	}, out)
+}
+
+func (f *Fake) API2(module, function string, arguments cpanelgo.Args, out interface{}) error {
+	return f.API2Context(context.Background(), module, function, arguments, out)
+}
+
+func (f *Fake) API2Context(ctx context.Context, module, function string, arguments cpanelgo.Args, out interface{}) error {
+	return f.Invoke(ctx, &cpanelgo.Call{
+		APIVersion: API2,
+		Module:     module,
+		Function:   function,
+		Args:       arguments,
+	}, out)
+}
+
+func (f *Fake) API1(module, function string, arguments []string, out interface{}) error {
+	return f.API1Context(context.Background(), module, function, arguments, out)
+}
+
+func (f *Fake) API1Context(ctx context.Context, module, function string, arguments []string, out interface{}) error {
+	return f.Invoke(ctx, &cpanelgo.Call{
+		APIVersion:     API1,
+		Module:         module,
+		Function:       function,
+		PositionalArgs: arguments,
+	}, out)
+}
+
+func (f *Fake) Close() error {
+	return nil
+}
+
+// CpanelApi returns a cPanel API backed by the fake.
+func (f *Fake) CpanelApi() cpanel.CpanelApi {
+	return cpanel.CpanelApi{Api: cpanelgo.NewApi(f)}
+}
+
+// WhmApi returns a WHM API client whose calls are all answered by the fake, keyed
+// by WHMAPI1 and the function name with an empty module.
+func (f *Fake) WhmApi() whm.WhmApi {
+	return whm.WhmApi{
+		Hostname:     "whm.example.com",
+		Username:     "root",
+		Interceptors: cpanelgo.Interceptors{f.Intercept},
+	}
+}
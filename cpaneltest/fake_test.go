@@ -0,0 +1,93 @@
+package cpaneltest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt-cpanel/cpanelgo"
+	"github.com/letsencrypt-cpanel/cpanelgo/cpanel"
+	"github.com/letsencrypt-cpanel/cpanelgo/whm"
+)
+
+// the gateways of this module all honour contexts rather than relying on the
+// fallback of cpanelgo.AsContextGateway
+var (
+	_ cpanelgo.ContextGateway = &cpanel.JsonApiGateway{}
+	_ cpanelgo.ContextGateway = &cpanel.LiveApiGateway{}
+	_ cpanelgo.ContextGateway = &whm.WhmImpersonationApi{}
+	_ cpanelgo.ContextGateway = &cpanelgo.RetryingGateway{}
+	_ cpanelgo.ContextGateway = &Fake{}
+	_ cpanelgo.ContextGateway = &recordingGateway{}
+)
+
+func TestFakeCpanelApi(t *testing.T) {
+	expiry := time.Now().Add(30 * 24 * time.Hour)
+	fake := NewFake().
+		Respond(UAPI, "SSL", "installed_hosts", InstalledHosts(InstalledCertificate(expiry.Unix(), "example.com", "www.example.com"))).
+		Respond(UAPI, "DomainInfo", "domains_data", DomainsData("bob", "example.com", []string{"addon.com"}, nil, []string{"sub.example.com"})).
+		Respond(API2, "ZoneEdit", "fetchzone", FetchZone(cpanel.ZoneRecord{Name: "example.com.", Type: "A", Record: "192.0.2.1"})).
+		Respond(UAPI, "Themes", "get_theme_base", `{"status":0,"errors":["Theme unavailable"]}`)
+	api := fake.CpanelApi()
+
+	hosts, err := api.InstalledHosts()
+	if err != nil || !hosts.HasDomain("www.example.com") || !hosts.DoesAnyValidCertificateOverlapVhostsWith("example.com", time.Now()) {
+		t.Errorf("unexpected installed hosts: %+v, %v", hosts, err)
+	}
+
+	domains, err := api.DomainsData()
+	if err != nil || len(domains.DomainList()) != 3 || domains.Data.Subdomains[0].DocumentRoot != "/home/bob/public_html/sub.example.com" {
+		t.Errorf("unexpected domains: %+v, %v", domains, err)
+	}
+
+	zone, err := api.FetchZone("example.com", "A")
+	if found, lines := zone.Find("example.com.", "A"); err != nil || !found || lines[0] != 1 {
+		t.Errorf("unexpected zone: %+v, %v", zone, err)
+	}
+
+	_, err = api.GetTheme()
+	var apiErr *cpanelgo.APIError
+	if !errors.As(err, &apiErr) || apiErr.Module != "Themes" || apiErr.Error() != "Theme unavailable" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if _, err := api.ListSSLKeys(); !errors.Is(err, ErrNoResponse) {
+		t.Errorf("expected ErrNoResponse, got: %v", err)
+	}
+
+	calls := fake.CallsTo(API2, "ZoneEdit", "fetchzone")
+	if len(calls) != 1 || calls[0].Args["domain"] != "example.com" {
+		t.Errorf("unexpected calls: %+v", calls)
+	}
+	if n := len(fake.Calls()); n != 5 {
+		t.Errorf("expected 5 calls, got: %d", n)
+	}
+}
+
+func TestFakeWhmApi(t *testing.T) {
+	injected := errors.New("connection reset")
+	fake := NewFake().
+		Respond(WHMAPI1, "", "version", WhmResult(map[string]string{"version": "11.90.0.5"})).
+		Fail(WHMAPI1, "", "listaccts", injected)
+	api := fake.WhmApi()
+
+	version, err := api.Version()
+	if err != nil || version.Data.Version != "11.90.0.5" {
+		t.Errorf("unexpected version: %+v, %v", version, err)
+	}
+	if _, err := api.ListAccounts(); err != injected {
+		t.Errorf("expected injected error, got: %v", err)
+	}
+
+	fake.Respond(WHMAPI1, "", "version", WhmError("Permission denied"))
+	_, err = api.Version()
+	var apiErr *cpanelgo.APIError
+	if !errors.As(err, &apiErr) || apiErr.Function != "version" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	fake.Reset()
+	if len(fake.Calls()) != 0 {
+		t.Error("calls were not reset")
+	}
+}
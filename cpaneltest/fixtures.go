@@ -0,0 +1,182 @@
+package cpaneltest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"time"
+
+	"github.com/letsencrypt-cpanel/cpanelgo"
+	"github.com/letsencrypt-cpanel/cpanelgo/cpanel"
+)
+
+// UAPIResult is a successful UAPI response with data
+func UAPIResult(data interface{}) interface{} {
+	return map[string]interface{}{
+		"status":   1,
+		"data":     data,
+		"errors":   nil,
+		"messages": nil,
+	}
+}
+
+// UAPIError is a failed UAPI response with errs
+func UAPIError(errs ...string) interface{} {
+	return map[string]interface{}{
+		"status":   0,
+		"data":     nil,
+		"errors":   errs,
+		"messages": nil,
+	}
+}
+
+// API2Result is a successful API2 response with data
+func API2Result(data interface{}) interface{} {
+	return map[string]interface{}{
+		"data":  data,
+		"event": map[string]interface{}{"result": 1},
+	}
+}
+
+// API2Error is a failed API2 response with reason
+func API2Error(reason string) interface{} {
+	return map[string]interface{}{
+		"data":  nil,
+		"event": map[string]interface{}{"result": 0, "reason": reason},
+	}
+}
+
+// WhmResult is a successful WHM API 1 response with data
+func WhmResult(data interface{}) interface{} {
+	return map[string]interface{}{
+		"metadata": map[string]interface{}{"result": 1, "reason": "OK", "version": 1},
+		"data":     data,
+	}
+}
+
+// WhmError is a failed WHM API 1 response with reason
+func WhmError(reason string) interface{} {
+	return map[string]interface{}{
+		"metadata": map[string]interface{}{"result": 0, "reason": reason, "version": 1},
+	}
+}
+
+// InstalledHosts is a response to SSL::installed_hosts listing hosts
+func InstalledHosts(hosts ...cpanel.InstalledCertificate) interface{} {
+	if hosts == nil {
+		hosts = []cpanel.InstalledCertificate{}
+	}
+	return UAPIResult(hosts)
+}
+
+// InstalledCertificate is a virtual host with a certificate for domains, the first
+// of which is the common name, expiring at notAfter (a Unix timestamp)
+func InstalledCertificate(notAfter int64, domains ...string) cpanel.InstalledCertificate {
+	var commonName string
+	if len(domains) > 0 {
+		commonName = domains[0]
+	}
+	return cpanel.InstalledCertificate{
+		Certificate: cpanel.CpanelSslCertificate{
+			Domains:    domains,
+			CommonName: cpanelgo.MaybeCommonNameString(commonName),
+			Id:         commonName + "_cert",
+			NotAfter:   cpanelgo.MaybeInt64(notAfter),
+			OrgName:    "Let's Encrypt",
+		},
+		FQDNs: domains,
+	}
+}
+
+// DomainsData is a response to DomainInfo::domains_data for user, whose main domain
+// is mainDomain. Addon and sub domains get their own document roots below the home
+// directory, as cPanel creates them by default.
+func DomainsData(user, mainDomain string, addonDomains, parkedDomains, subDomains []string) interface{} {
+	domain := func(d, docroot string) cpanel.DomainsDataDomain {
+		return cpanel.DomainsDataDomain{
+			Domain:       d,
+			Ip:           "192.0.2.1",
+			DocumentRoot: docroot,
+			User:         user,
+			ServerAlias:  "www." + d,
+			ServerName:   d,
+		}
+	}
+
+	addons := []cpanel.DomainsDataDomain{}
+	for _, d := range addonDomains {
+		addons = append(addons, domain(d, "/home/"+user+"/"+d))
+	}
+	subs := []cpanel.DomainsDataDomain{}
+	for _, d := range subDomains {
+		subs = append(subs, domain(d, "/home/"+user+"/public_html/"+d))
+	}
+	if parkedDomains == nil {
+		parkedDomains = []string{}
+	}
+
+	return UAPIResult(map[string]interface{}{
+		"main_domain":    domain(mainDomain, "/home/"+user+"/public_html"),
+		"addon_domains":  addons,
+		"parked_domains": parkedDomains,
+		"sub_domains":    subs,
+	})
+}
+
+// FetchZone is a response to ZoneEdit::fetchzone with records, numbered by line
+// if they have none
+func FetchZone(records ...cpanel.ZoneRecord) interface{} {
+	rs := make([]cpanel.ZoneRecord, len(records))
+	for i, r := range records {
+		if r.Line == 0 {
+			r.Line = i + 1
+		}
+		rs[i] = r
+	}
+	return API2Result([]interface{}{
+		map[string]interface{}{
+			"record":    rs,
+			"status":    1,
+			"statusmsg": "Zone Serialized",
+		},
+	})
+}
+
+// NewCertificate creates a self-signed certificate for domains, the first of which
+// is the common name, valid until notAfter. It returns the certificate and its
+// private key in PEM format, as passed to SSL::install_ssl.
+func NewCertificate(notAfter time.Time, domains ...string) (string, string, error) {
+	pk, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", "", err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return "", "", err
+	}
+
+	var commonName string
+	if len(domains) > 0 {
+		commonName = domains[0]
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     domains,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &pk.PublicKey, pk)
+	if err != nil {
+		return "", "", err
+	}
+
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	key := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(pk)})
+	return string(cert), string(key), nil
+}
@@ -0,0 +1,364 @@
+package cpaneltest
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/letsencrypt-cpanel/cpanelgo"
+)
+
+// LiveOutput shapes how a LiveServer writes its responses, to exercise the reader
+// of LiveApiGateway against the ways real output arrives.
+type LiveOutput struct {
+	// Write responses in pieces of this many bytes, zero writes them at once
+	Chunk int
+	// Pause before every piece
+	Delay time.Duration
+	// Close the connection after this many bytes of the next response, zero never does
+	Truncate int
+	// Emitted as <error>ErrorPrefix</error> in front of the JSON of every response,
+	// as cPanel does for warnings raised while processing a request
+	ErrorPrefix string
+	// Leave out the newline cpsrvd writes after </cpanelresult>
+	NoNewline bool
+	// Close the connection on <cpanelxml shutdown="1" /> without answering, as
+	// cpsrvd may
+	DropShutdown bool
+}
+
+// LiveServer is a fake cPanel LiveAPI server listening on a unix socket in a
+// temporary directory. It speaks the length prefixed request and <cpanelresult>
+// framed response protocol, enables JSON on <cpaneljson enable="1">, answers
+// <cpanelaction> calls from a Fake, wrapped the way LiveAPI wraps each API version,
+// expands <cpanelif>, <cpanelfeature> and <cpanel print="..."> directives from what
+// was set with SetCondition, SetFeature and SetVariable, and closes the connection
+// after <cpanelxml shutdown="1" />.
+type LiveServer struct {
+	// The socket to connect to, e.g. with cpanel.NewLiveApi("unix", s.Path)
+	Path string
+	// Answers the calls
+	Fake *Fake
+
+	listener net.Listener
+	dir      string
+	wg       sync.WaitGroup
+
+	mu         sync.Mutex
+	output     LiveOutput
+	requests   []string
+	conns      map[net.Conn]bool
+	conditions map[string]bool
+	features   map[string]bool
+	variables  map[string]string
+}
+
+// NewLiveServer starts a LiveAPI server answering calls from f. Close it when done.
+func NewLiveServer(f *Fake) (*LiveServer, error) {
+	dir, err := ioutil.TempDir("", "cpaneltest")
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, "cpanel.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	s := &LiveServer{
+		Path:     path,
+		Fake:     f,
+		listener: l,
+		dir:      dir,
+		conns:    map[net.Conn]bool{},
+
+		conditions: map[string]bool{},
+		features:   map[string]bool{},
+		variables:  map[string]string{},
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Close stops listening, closes open connections and removes the socket.
+func (s *LiveServer) Close() error {
+	err := s.listener.Close()
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	os.RemoveAll(s.dir)
+	return err
+}
+
+// Disconnect closes the open connections, as cpsrvd does when it restarts, while
+// still accepting new ones.
+func (s *LiveServer) Disconnect() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+// SetOutput changes how the following responses are written.
+func (s *LiveServer) SetOutput(o LiveOutput) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.output = o
+}
+
+// SetCondition sets what <cpanelif code> evaluates to, false by default.
+func (s *LiveServer) SetCondition(code string, result bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.conditions[code] = result
+}
+
+// SetFeature grants or denies feature to the account, denied by default.
+func (s *LiveServer) SetFeature(feature string, enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.features[feature] = enabled
+}
+
+// SetVariable sets what <cpanel print="variable"> expands to, e.g.
+// SetVariable(cpanel.LiveVarHomeDir, "/home/user"). Unset variables expand to an
+// empty string.
+func (s *LiveServer) SetVariable(variable, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.variables[variable] = value
+}
+
+// Requests returns the raw requests received so far, oldest first.
+func (s *LiveServer) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.requests...)
+}
+
+func (s *LiveServer) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = true
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.serveConn(conn)
+
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+func (s *LiveServer) serveConn(conn net.Conn) {
+	rd := bufio.NewReader(conn)
+	for {
+		req, err := readLiveRequest(rd)
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.requests = append(s.requests, req)
+		output := s.output
+		s.output.Truncate = 0
+		s.mu.Unlock()
+
+		if req == `<cpanelxml shutdown="1" />` {
+			if !output.DropShutdown {
+				writeLiveResponse(conn, `{"data":{"result":"shutdown"}}`, output)
+			}
+			return
+		}
+		if !writeLiveResponse(conn, s.respond(req), output) {
+			return
+		}
+	}
+}
+
+// readLiveRequest reads a request of the form "<length>\n<request>"
+func readLiveRequest(rd *bufio.Reader) (string, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil || n < 0 {
+		return "", fmt.Errorf("invalid request length: %q", line)
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(rd, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// respond returns the JSON answering req
+func (s *LiveServer) respond(req string) string {
+	switch {
+	case req == `<cpaneljson enable="1">`:
+		return `{"data":{"result":"json"}}`
+	case strings.HasPrefix(req, "<cpanelaction>") && strings.HasSuffix(req, "</cpanelaction>"):
+		return s.action(strings.TrimSuffix(strings.TrimPrefix(req, "<cpanelaction>"), "</cpanelaction>"))
+	case strings.HasPrefix(req, "<cpanelif ") && strings.HasSuffix(req, ">"):
+		s.mu.Lock()
+		result := s.conditions[strings.TrimSuffix(strings.TrimPrefix(req, "<cpanelif "), ">")]
+		s.mu.Unlock()
+		return liveDirective(liveFlag(result))
+	case strings.HasPrefix(req, "<cpanelfeature ") && strings.HasSuffix(req, ">"):
+		s.mu.Lock()
+		enabled := s.features[strings.TrimSuffix(strings.TrimPrefix(req, "<cpanelfeature "), ">")]
+		s.mu.Unlock()
+		return liveDirective(liveFlag(enabled))
+	case strings.HasPrefix(req, `<cpanel print="`) && strings.HasSuffix(req, `">`):
+		s.mu.Lock()
+		value := s.variables[strings.TrimSuffix(strings.TrimPrefix(req, `<cpanel print="`), `">`)]
+		s.mu.Unlock()
+		return liveDirective(value)
+	}
+	return liveError(fmt.Sprintf("Unknown request: %s", req))
+}
+
+type liveAction struct {
+	Module     string          `json:"module"`
+	Function   string          `json:"func"`
+	ApiVersion string          `json:"apiversion"`
+	Args       json.RawMessage `json:"args"`
+}
+
+func (s *LiveServer) action(req string) string {
+	var action liveAction
+	if err := json.Unmarshal([]byte(req), &action); err != nil {
+		return liveError(fmt.Sprintf("Invalid action: %v", err))
+	}
+
+	call := &cpanelgo.Call{
+		APIVersion: action.ApiVersion,
+		Module:     action.Module,
+		Function:   action.Function,
+	}
+	if len(action.Args) > 0 && string(action.Args) != "null" {
+		var err error
+		if action.ApiVersion == API1 {
+			err = json.Unmarshal(action.Args, &call.PositionalArgs)
+		} else {
+			err = json.Unmarshal(action.Args, &call.Args)
+		}
+		if err != nil {
+			return liveError(fmt.Sprintf("Invalid arguments: %v", err))
+		}
+	}
+
+	var result json.RawMessage
+	if err := s.Fake.Invoke(context.Background(), call, &result); err != nil {
+		return liveError(err.Error())
+	}
+
+	var wrapped interface{}
+	switch action.ApiVersion {
+	case UAPI:
+		wrapped = map[string]interface{}{
+			"apiversion": 3,
+			"module":     action.Module,
+			"func":       action.Function,
+			"result":     result,
+		}
+	case API2:
+		wrapped = map[string]interface{}{"cpanelresult": result}
+	default:
+		wrapped = result
+	}
+	buf, _ := json.Marshal(wrapped)
+	return string(buf)
+}
+
+// liveDirective wraps the result of a directive the way cpsrvd does
+func liveDirective(result string) string {
+	buf, _ := json.Marshal(map[string]interface{}{
+		"cpanelresult": map[string]interface{}{
+			"data": map[string]string{"result": result},
+		},
+	})
+	return string(buf)
+}
+
+func liveFlag(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+func liveError(message string) string {
+	buf, _ := json.Marshal(map[string]string{"error": message})
+	return string(buf)
+}
+
+// writeLiveResponse frames body and writes it shaped by o, returning false once the
+// connection should be closed
+func writeLiveResponse(conn net.Conn, body string, o LiveOutput) bool {
+	out := `<?xml version="1.0" ?>` + "\n<cpanelresult>"
+	if o.ErrorPrefix != "" {
+		out += "<error>" + o.ErrorPrefix + "</error>"
+	}
+	out += body + "</cpanelresult>"
+	if !o.NoNewline {
+		out += "\n"
+	}
+
+	truncated := false
+	if o.Truncate > 0 && o.Truncate < len(out) {
+		out, truncated = out[:o.Truncate], true
+	}
+
+	chunk := o.Chunk
+	if chunk <= 0 {
+		chunk = len(out)
+	}
+	for len(out) > 0 {
+		if o.Delay > 0 {
+			time.Sleep(o.Delay)
+		}
+		n := chunk
+		if n > len(out) {
+			n = len(out)
+		}
+		if _, err := io.WriteString(conn, out[:n]); err != nil {
+			return false
+		}
+		out = out[n:]
+	}
+	return !truncated
+}
@@ -0,0 +1,302 @@
+package cpaneltest
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt-cpanel/cpanelgo"
+	"github.com/letsencrypt-cpanel/cpanelgo/cpanel"
+)
+
+func TestLiveServer(t *testing.T) {
+	fake := NewFake().
+		Respond(UAPI, "Themes", "get_theme_base", UAPIResult("paper_lantern")).
+		Respond(API2, "ZoneEdit", "fetchzone", FetchZone(cpanel.ZoneRecord{Name: "example.com.", Type: "A", Record: "192.0.2.1"}))
+	s, err := NewLiveServer(fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	api, err := cpanel.NewLiveApi("unix", s.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer api.Close()
+
+	tests := []LiveOutput{
+		{},
+		{Chunk: 7, Delay: time.Millisecond},
+		{ErrorPrefix: "A warning occurred while processing this directive."},
+		{NoNewline: true},
+	}
+	for _, output := range tests {
+		s.SetOutput(output)
+		theme, err := api.GetTheme()
+		if err != nil || theme.Theme != "paper_lantern" {
+			t.Errorf("%+v: unexpected theme: %+v, %v", output, theme, err)
+		}
+		if warnings := theme.ResponseInfo().Warnings; output.ErrorPrefix != "" && (len(warnings) != 1 || warnings[0] != output.ErrorPrefix) {
+			t.Errorf("%+v: unexpected warnings: %q", output, warnings)
+		}
+		zone, err := api.FetchZone("example.com", "A")
+		if found, _ := zone.Find("example.com.", "A"); err != nil || !found {
+			t.Errorf("%+v: unexpected zone: %+v, %v", output, zone, err)
+		}
+	}
+
+	requests := s.Requests()
+	if len(requests) != 9 || requests[0] != `<cpaneljson enable="1">` || !strings.Contains(requests[2], `"domain":"example.com"`) {
+		t.Errorf("unexpected requests: %q", requests)
+	}
+	if calls := fake.CallsTo(API2, "ZoneEdit", "fetchzone"); len(calls) != 4 || calls[0].Args["type"] != "A" {
+		t.Errorf("unexpected calls: %+v", calls)
+	}
+
+	if _, err := api.ListSSLKeys(); err == nil || !strings.Contains(err.Error(), "no response for call") {
+		t.Errorf("expected the error of the fake, got: %v", err)
+	}
+
+	s.SetOutput(LiveOutput{Truncate: 40})
+	if _, err := api.GetTheme(); !errors.Is(err, cpanel.ErrIncompleteResponse) {
+		t.Errorf("expected %v for truncated output, got: %v", cpanel.ErrIncompleteResponse, err)
+	}
+	if theme, err := api.GetTheme(); err != nil || theme.Theme != "paper_lantern" {
+		t.Errorf("unexpected theme after reconnecting: %+v, %v", theme, err)
+	}
+}
+
+func TestLiveServerConcurrency(t *testing.T) {
+	fake := NewFake()
+	for i := 0; i < 8; i++ {
+		fake.Respond(UAPI, "NVData", fmt.Sprintf("get%d", i), UAPIResult(i))
+	}
+	s, err := NewLiveServer(fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.SetOutput(LiveOutput{Chunk: 5})
+
+	api, err := cpanel.NewLiveApi("unix", s.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer api.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for n := 0; n < 10; n++ {
+				var out struct {
+					Data int `json:"data"`
+				}
+				if err := api.Gateway.UAPI("NVData", fmt.Sprintf("get%d", i), nil, &out); err != nil || out.Data != i {
+					t.Errorf("get%d: unexpected result: %d, %v", i, out.Data, err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestLiveServerReconnect(t *testing.T) {
+	s, err := NewLiveServer(NewFake().Respond(UAPI, "Themes", "get_theme_base", UAPIResult("paper_lantern")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	api, err := cpanel.NewLiveApi("unix", s.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer api.Close()
+
+	for i := 0; i < 3; i++ {
+		s.Disconnect()
+		// the first call may still find the old socket writable and only learn at
+		// the read that it is gone
+		theme, err := api.GetTheme()
+		if err != nil {
+			if !errors.Is(err, cpanel.ErrIncompleteResponse) {
+				t.Fatalf("unexpected error on a dropped connection: %v", err)
+			}
+			theme, err = api.GetTheme()
+		}
+		if err != nil || theme.Theme != "paper_lantern" {
+			t.Fatalf("unexpected theme after reconnecting: %+v, %v", theme, err)
+		}
+	}
+
+	enabled := 0
+	for _, req := range s.Requests() {
+		if req == `<cpaneljson enable="1">` {
+			enabled++
+		}
+	}
+	if enabled != 4 {
+		t.Errorf("expected JSON to be enabled on every connection, got: %q", s.Requests())
+	}
+}
+
+func TestLiveServerDroppedShutdown(t *testing.T) {
+	s, err := NewLiveServer(NewFake().Respond(UAPI, "Themes", "get_theme_base", UAPIResult("paper_lantern")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	api, err := cpanel.NewLiveApi("unix", s.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.GetTheme(); err != nil {
+		t.Fatal(err)
+	}
+
+	s.SetOutput(LiveOutput{DropShutdown: true})
+	if err := api.Close(); err != nil {
+		t.Errorf("unexpected error on close: %v", err)
+	}
+	if err := api.Close(); err != nil {
+		t.Errorf("unexpected error on a second close: %v", err)
+	}
+	if requests := s.Requests(); requests[len(requests)-1] != `<cpanelxml shutdown="1" />` {
+		t.Errorf("no shutdown handshake: %q", requests)
+	}
+}
+
+func TestLiveApiFromEnv(t *testing.T) {
+	for _, name := range []string{"CPANEL_CONNECT_FILE", "CPANEL_CONNECT_SOCKET", "CPANEL_PHPCONNECT_SOCKET"} {
+		t.Setenv(name, "")
+	}
+
+	if _, err := cpanel.NewLiveApiFromEnv(); err != cpanel.ErrNotUnderCpsrvd {
+		t.Errorf("expected %v, got: %v", cpanel.ErrNotUnderCpsrvd, err)
+	}
+
+	s, err := NewLiveServer(NewFake().Respond(UAPI, "Themes", "get_theme_base", UAPIResult("paper_lantern")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	t.Setenv("CPANEL_CONNECT_FILE", s.Path)
+	api, err := cpanel.NewLiveApiFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if theme, err := api.GetTheme(); err != nil || theme.Theme != "paper_lantern" {
+		t.Errorf("unexpected theme: %+v, %v", theme, err)
+	}
+	if err := api.Close(); err != nil {
+		t.Errorf("unexpected error on close: %v", err)
+	}
+	if requests := s.Requests(); requests[len(requests)-1] != `<cpanelxml shutdown="1" />` {
+		t.Errorf("no shutdown handshake: %q", requests)
+	}
+}
+
+func TestLiveServerDirectives(t *testing.T) {
+	s, err := NewLiveServer(NewFake())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.SetCondition("$haspostgres", true)
+	s.SetFeature("sslinstall", true)
+	s.SetVariable(cpanel.LiveVarHomeDir, "/home/user")
+	s.SetVariable(cpanel.LiveVarContactEmail, "user@example.com")
+
+	api, err := cpanel.NewLiveApi("unix", s.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer api.Close()
+	gw := api.Gateway.(*cpanel.LiveApiGateway)
+
+	if ok, err := gw.CpanelIf("$haspostgres"); err != nil || !ok {
+		t.Errorf("unexpected condition: %v, %v", ok, err)
+	}
+	if ok, err := gw.CpanelIf("$isreseller"); err != nil || ok {
+		t.Errorf("unexpected condition: %v, %v", ok, err)
+	}
+	if ok, err := gw.CpanelFeature("sslinstall"); err != nil || !ok {
+		t.Errorf("unexpected feature: %v, %v", ok, err)
+	}
+	if ok, err := gw.CpanelFeature("autossl"); err != nil || ok {
+		t.Errorf("unexpected feature: %v, %v", ok, err)
+	}
+	if dir, err := gw.HomeDir(); err != nil || dir != "/home/user" {
+		t.Errorf("unexpected home directory: %q, %v", dir, err)
+	}
+	if email, err := gw.ContactEmail(); err != nil || email != "user@example.com" {
+		t.Errorf("unexpected contact email: %q, %v", email, err)
+	}
+	if domain, err := gw.MainDomain(); err != nil || domain != "" {
+		t.Errorf("unexpected main domain: %q, %v", domain, err)
+	}
+	if _, err := gw.CpanelIf("1><cpanelxml shutdown=\"1\" /"); err == nil {
+		t.Error("expected a value ending the directive early to be rejected")
+	}
+
+	requests := s.Requests()
+	if len(requests) != 8 || requests[3] != "<cpanelfeature sslinstall>" || requests[5] != `<cpanel print="$homedir">` {
+		t.Errorf("unexpected requests: %q", requests)
+	}
+}
+
+func TestLiveServerArgs(t *testing.T) {
+	fake := NewFake().Respond(UAPI, "Mod", "set", UAPIResult(nil))
+	s, err := NewLiveServer(fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	api, err := cpanel.NewLiveApi("unix", s.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer api.Close()
+
+	args := cpanelgo.Args{
+		"raw":     []byte("contents"),
+		"ip":      net.ParseIP("192.0.2.1"),
+		"ttl":     90 * time.Second,
+		"ips":     []net.IP{net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2")},
+		"enabled": true,
+		"record":  cpanelgo.JSON(map[string]string{"type": "A"}),
+	}
+	var out cpanelgo.UAPIResult
+	if err := api.Gateway.UAPI("Mod", "set", args, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	// the values are those the HTTP gateways send
+	params, _ := cpanelgo.EncodeArgs(args, nil)
+	expected := params.Values()
+	received := fake.CallsTo(UAPI, "Mod", "set")[0].Args
+	for name, values := range expected {
+		var got interface{} = values[0]
+		if len(values) > 1 {
+			got = []interface{}{values[0], values[1]}
+		}
+		if !reflect.DeepEqual(received[name], got) {
+			t.Errorf("%s: expected %q, got: %#v", name, values, received[name])
+		}
+	}
+	if received["ttl"] != "1m30s" || received["raw"] != "contents" {
+		t.Errorf("unexpected arguments: %v", received)
+	}
+}
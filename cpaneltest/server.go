@@ -0,0 +1,452 @@
+package cpaneltest
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/letsencrypt-cpanel/cpanelgo"
+	"github.com/letsencrypt-cpanel/cpanelgo/cpanel"
+	"github.com/letsencrypt-cpanel/cpanelgo/whm"
+)
+
+// Account is a cPanel account hosted by a Server.
+type Account struct {
+	User     string
+	Password string
+	// cPanel API token, accepted instead of the password when set
+	Token string
+	// Base32 secret required to log in with a session when set
+	TotpSecret string
+	Email      string
+	Suspended  bool
+
+	MainDomain    string
+	AddonDomains  []string
+	ParkedDomains []string
+	SubDomains    []string
+}
+
+// Server is an in-process cPanel and WHM server speaking the real wire protocol,
+// so that JsonApiGateway, WhmApi and WhmImpersonationApi can be tested end to end.
+// Cpanel serves what a real server serves on port 2083, /execute/Module/function
+// and /json-api/cpanel, and Whm what it serves on port 2087, /json-api/function.
+// Both log in sessions at /login/?login_only=1.
+//
+// The state of SSL (keys, certificates and installed hosts), ZoneEdit, DomainInfo
+// and NVData is kept per account, so calls see the effects of earlier calls.
+type Server struct {
+	Cpanel *httptest.Server
+	Whm    *httptest.Server
+
+	// WHM credentials, each accepted when set
+	WhmUser       string
+	WhmAccessHash string
+	WhmToken      string
+	WhmPassword   string
+	// Base32 secret of the one-time passwords WHM requires when set
+	WhmTotpSecret string
+
+	mu       sync.Mutex
+	accounts map[string]*accountState
+	// security token to the user it was issued to, "" for the WHM user
+	sessions map[string]session
+	nextID   int
+}
+
+type session struct {
+	user   string
+	whm    bool
+	cookie string
+}
+
+// NewServer starts a server with the WHM user root, accepting the access hash
+// "ACCESSHASH" and the API token "WHMTOKEN". Close it when done.
+func NewServer() *Server {
+	s := &Server{
+		WhmUser:       "root",
+		WhmAccessHash: "ACCESSHASH",
+		WhmToken:      "WHMTOKEN",
+		accounts:      map[string]*accountState{},
+		sessions:      map[string]session{},
+	}
+	s.Cpanel = httptest.NewTLSServer(http.HandlerFunc(s.serveCpanel))
+	s.Whm = httptest.NewTLSServer(http.HandlerFunc(s.serveWhm))
+	return s
+}
+
+func (s *Server) Close() {
+	s.Cpanel.Close()
+	s.Whm.Close()
+}
+
+// AddAccount creates a cPanel account, replacing any account of the same user.
+func (s *Server) AddAccount(a Account) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.accounts[a.User] = newAccountState(a)
+}
+
+func endpoint(srv *httptest.Server) cpanelgo.Endpoint {
+	e, _ := cpanelgo.ParseEndpoint(srv.URL)
+	return e
+}
+
+// CpanelEndpoint is the endpoint to give cPanel gateways instead of port 2083
+func (s *Server) CpanelEndpoint() cpanelgo.Endpoint {
+	return endpoint(s.Cpanel)
+}
+
+// WhmEndpoint is the endpoint to give WHM clients instead of port 2087
+func (s *Server) WhmEndpoint() cpanelgo.Endpoint {
+	return endpoint(s.Whm)
+}
+
+// CpanelApi returns a JsonApiGateway logging into the server as user with password.
+func (s *Server) CpanelApi(user, password string) cpanel.CpanelApi {
+	api, _ := cpanel.NewJsonApiWithClient("localhost", user, password, false, s.Cpanel.Client())
+	e := s.CpanelEndpoint()
+	api.Gateway.(*cpanel.JsonApiGateway).Endpoint = &e
+	return api
+}
+
+// WhmApi returns a WHM client authenticating with the access hash of the server.
+func (s *Server) WhmApi() whm.WhmApi {
+	return whm.NewWhmApiAccessHashWithClient("localhost", s.WhmUser, s.WhmAccessHash, false, s.Whm.Client()).
+		WithEndpoint(s.WhmEndpoint())
+}
+
+// ImpersonationApi returns a cPanel API for user, impersonated through WHM with the
+// access hash of the server.
+func (s *Server) ImpersonationApi(user string) cpanel.CpanelApi {
+	api := whm.NewWhmImpersonationApiWithClient("localhost", s.WhmUser, s.WhmAccessHash, user, false, s.Whm.Client())
+	e := s.WhmEndpoint()
+	api.Gateway.(*whm.WhmImpersonationApi).Endpoint = &e
+	return api
+}
+
+var securityTokenPath = regexp.MustCompile(`^/cpsess[0-9]+`)
+
+// login handles POST /login/?login_only=1, checking the credentials with check
+func (s *Server) login(w http.ResponseWriter, r *http.Request, whm bool, check func(user, pass, otp string) bool) {
+	if r.Method != "POST" || !check(r.FormValue("user"), r.FormValue("pass"), r.FormValue("tfa_token")) {
+		w.WriteHeader(http.StatusUnauthorized)
+		writeJSON(w, map[string]interface{}{"status": 0, "message": "invalid_login"})
+		return
+	}
+
+	s.mu.Lock()
+	s.nextID++
+	token := fmt.Sprintf("/cpsess%010d", s.nextID)
+	sess := session{user: r.FormValue("user"), whm: whm, cookie: fmt.Sprintf("%s:%d", r.FormValue("user"), s.nextID)}
+	s.sessions[token] = sess
+	s.mu.Unlock()
+
+	name := "cpsession"
+	if whm {
+		name = "whostmgrsession"
+	}
+	http.SetCookie(w, &http.Cookie{Name: name, Value: url.QueryEscape(sess.cookie), Path: "/"})
+	writeJSON(w, map[string]interface{}{"status": 1, "security_token": token})
+}
+
+// sessionUser returns the user of the session the request belongs to, and the path
+// below the security token
+func (s *Server) sessionUser(r *http.Request, whm bool) (string, string, bool) {
+	token := securityTokenPath.FindString(r.URL.Path)
+	if token == "" {
+		return "", r.URL.Path, false
+	}
+	path := strings.TrimPrefix(r.URL.Path, token)
+
+	s.mu.Lock()
+	sess, ok := s.sessions[token]
+	s.mu.Unlock()
+
+	name := "cpsession"
+	if whm {
+		name = "whostmgrsession"
+	}
+	c, err := r.Cookie(name)
+	if !ok || sess.whm != whm || err != nil || c.Value != url.QueryEscape(sess.cookie) {
+		return "", path, false
+	}
+	return sess.user, path, true
+}
+
+// credentials parses the Authorization header, returning its scheme and user:secret
+func credentials(r *http.Request) (string, string, string) {
+	auth := r.Header.Get("Authorization")
+	sp := strings.SplitN(auth, " ", 2)
+	if len(sp) != 2 {
+		return "", "", ""
+	}
+	value := sp[1]
+	if sp[0] == "Basic" {
+		buf, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return "", "", ""
+		}
+		value = string(buf)
+	}
+	up := strings.SplitN(value, ":", 2)
+	if len(up) != 2 {
+		return "", "", ""
+	}
+	return sp[0], up[0], up[1]
+}
+
+func equal(a, b string) bool {
+	return a != "" && subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// validOTP accepts one-time passwords of the current and the previous period
+func validOTP(secret, otp string) bool {
+	now := time.Now()
+	for _, t := range []time.Time{now, now.Add(-30 * time.Second)} {
+		if expected, err := cpanelgo.TOTP(secret, t); err == nil && equal(otp, expected) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) serveCpanel(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/login/" {
+		s.login(w, r, false, func(user, pass, otp string) bool {
+			a := s.account(user)
+			return a != nil && equal(pass, a.Password) && (a.TotpSecret == "" || validOTP(a.TotpSecret, otp))
+		})
+		return
+	}
+
+	user, path, ok := s.sessionUser(r, false)
+	if !ok {
+		scheme, u, secret := credentials(r)
+		a := s.account(u)
+		switch {
+		case a == nil:
+		case scheme == "Basic" && equal(secret, a.Password):
+			user, ok = u, true
+		case scheme == "cpanel" && equal(secret, a.Token):
+			user, ok = u, true
+		}
+	}
+	if !ok {
+		http.Error(w, "Access denied", http.StatusUnauthorized)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(path, "/execute/"):
+		sp := strings.Split(strings.TrimPrefix(path, "/execute/"), "/")
+		if len(sp) != 2 {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, s.uapi(user, sp[0], sp[1], r.Form))
+	case path == "/json-api/cpanel":
+		writeJSON(w, s.cpanelJSONAPI(user, r.Form, false))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// cpanelJSONAPI answers a call of API2 or API1 (or UAPI through WHM) for user,
+// described by the cpanel_jsonapi_* parameters
+func (s *Server) cpanelJSONAPI(user string, form url.Values, viaWhm bool) interface{} {
+	module, function := form.Get("cpanel_jsonapi_module"), form.Get("cpanel_jsonapi_func")
+	switch form.Get("cpanel_jsonapi_apiversion") {
+	case "3":
+		if viaWhm {
+			return map[string]interface{}{"result": s.uapi(user, module, function, form)}
+		}
+	case "2":
+		return map[string]interface{}{"cpanelresult": s.api2(user, module, function, form)}
+	case "1":
+		return api1Error(module, function, fmt.Sprintf("Could not find function “%s” in module “%s”", function, module))
+	}
+	return api1Error(module, function, "Unsupported API version")
+}
+
+func (s *Server) serveWhm(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/login/" {
+		s.login(w, r, true, func(user, pass, otp string) bool {
+			return equal(user, s.WhmUser) && equal(pass, s.WhmPassword) &&
+				(s.WhmTotpSecret == "" || validOTP(s.WhmTotpSecret, otp))
+		})
+		return
+	}
+
+	_, path, ok := s.sessionUser(r, true)
+	if !ok {
+		scheme, u, secret := credentials(r)
+		ok = equal(u, s.WhmUser) &&
+			(scheme == "Basic" && equal(secret, s.WhmPassword) ||
+				scheme == "whm" && equal(secret, s.WhmToken) ||
+				scheme == "WHM" && equal(secret, s.WhmAccessHash))
+		if ok && s.WhmTotpSecret != "" && !validOTP(s.WhmTotpSecret, r.Header.Get("X-CPANEL-OTP")) {
+			w.WriteHeader(http.StatusForbidden)
+			writeJSON(w, whmError("", "Two-factor authentication failed"))
+			return
+		}
+	}
+	if !ok {
+		http.Error(w, "Access denied", http.StatusUnauthorized)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !strings.HasPrefix(path, "/json-api/") {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, s.whmapi1(strings.TrimPrefix(path, "/json-api/"), r.Form))
+}
+
+func (s *Server) whmapi1(function string, form url.Values) interface{} {
+	switch function {
+	case "version":
+		return whmResult(function, map[string]string{"version": "11.90.0.5"})
+	case "listaccts":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		users := make([]string, 0, len(s.accounts))
+		for user := range s.accounts {
+			users = append(users, user)
+		}
+		sort.Strings(users)
+		accts := []interface{}{}
+		for _, user := range users {
+			accts = append(accts, s.accounts[user].summary())
+		}
+		if form.Get("api.chunk.enable") != "1" {
+			return whmResult(function, map[string]interface{}{"acct": accts})
+		}
+		page, chunk := whmChunk(accts, form)
+		result := whmResult(function, map[string]interface{}{"acct": page}).(map[string]interface{})
+		result["metadata"].(map[string]interface{})["chunk"] = chunk
+		return result
+	case "accountsummary":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		a, ok := s.accounts[form.Get("user")]
+		if !ok {
+			return whmError(function, fmt.Sprintf("Account “%s” does not exist.", form.Get("user")))
+		}
+		return whmResult(function, map[string]interface{}{"acct": []interface{}{a.summary()}})
+	case "batch":
+		results := []interface{}{}
+		for _, command := range form["command"] {
+			sp := strings.SplitN(command, "?", 2)
+			vals := url.Values{}
+			if len(sp) == 2 {
+				var err error
+				if vals, err = url.ParseQuery(sp[1]); err != nil {
+					return whmError(function, fmt.Sprintf("Invalid batch command: %s", command))
+				}
+			}
+			results = append(results, s.whmapi1(sp[0], vals))
+		}
+		return whmResult(function, map[string]interface{}{"result": results})
+	case "cpanel":
+		user := form.Get("cpanel_jsonapi_user")
+		if s.account(user) == nil {
+			return whmError(function, fmt.Sprintf("User parameter is invalid or was not supplied: %s", user))
+		}
+		return s.cpanelJSONAPI(user, form, true)
+	}
+	return whmError(function, fmt.Sprintf("Unknown app (“%s”) requested for this version (1) of the API.", function))
+}
+
+func (s *Server) account(user string) *accountState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.accounts[user]
+}
+
+// whmChunk selects the chunk of records requested by api.chunk.size and
+// api.chunk.start, returning it and the chunk metadata WHM returns along with it
+func whmChunk(records []interface{}, form url.Values) ([]interface{}, map[string]int) {
+	size, _ := strconv.Atoi(form.Get("api.chunk.size"))
+	start, _ := strconv.Atoi(form.Get("api.chunk.start"))
+	if size < 1 {
+		size = len(records) + 1
+	}
+	if start < 1 {
+		start = 1
+	}
+
+	page := []interface{}{}
+	if start <= len(records) {
+		end := start - 1 + size
+		if end > len(records) {
+			end = len(records)
+		}
+		page = records[start-1 : end]
+	}
+	return page, map[string]int{
+		"start":   start,
+		"size":    size,
+		"records": len(records),
+		"current": (start-1)/size + 1,
+		"chunks":  (len(records) + size - 1) / size,
+	}
+}
+
+func whmResult(command string, data interface{}) interface{} {
+	return map[string]interface{}{
+		"metadata": map[string]interface{}{"result": 1, "reason": "OK", "version": 1, "command": command},
+		"data":     data,
+	}
+}
+
+func whmError(command, reason string) interface{} {
+	return map[string]interface{}{
+		"metadata": map[string]interface{}{"result": 0, "reason": reason, "version": 1, "command": command},
+	}
+}
+
+func api1Error(module, function, reason string) interface{} {
+	return map[string]interface{}{
+		"apiversion": "1",
+		"module":     module,
+		"func":       function,
+		"data":       map[string]string{"result": ""},
+		"error":      reason,
+		"event":      map[string]interface{}{"result": 0, "reason": reason},
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(buf)))
+	w.Write(buf)
+}
@@ -0,0 +1,649 @@
+package cpaneltest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type sslKey struct {
+	id           string
+	friendlyName string
+	text         string
+	modulus      string
+	bits         int
+	created      int64
+}
+
+type sslCert struct {
+	id      string
+	text    string
+	cert    *x509.Certificate
+	modulus string
+}
+
+type zoneRecord struct {
+	name    string
+	rrType  string
+	record  string
+	ttl     int
+	deleted bool
+}
+
+// accountState is an Account together with the state of its cPanel modules
+type accountState struct {
+	Account
+	keys  []*sslKey
+	certs []*sslCert
+	// certificate installed on each virtual host
+	installed map[string]*sslCert
+	// records of each zone, the line of a record is its index plus one
+	zones  map[string][]*zoneRecord
+	nvdata map[string]string
+}
+
+func newAccountState(a Account) *accountState {
+	s := &accountState{
+		Account:   a,
+		installed: map[string]*sslCert{},
+		zones:     map[string][]*zoneRecord{},
+		nvdata:    map[string]string{},
+	}
+
+	for _, d := range append([]string{a.MainDomain}, append(a.AddonDomains, a.ParkedDomains...)...) {
+		s.zones[d] = []*zoneRecord{
+			{name: d + ".", rrType: "SOA", record: "ns1." + d + ". hostmaster." + d + ". 2020010100 3600 1800 1209600 86400", ttl: 86400},
+			{name: d + ".", rrType: "NS", record: "ns1." + d, ttl: 86400},
+			{name: d + ".", rrType: "A", record: "192.0.2.1", ttl: 14400},
+			{name: "www." + d + ".", rrType: "CNAME", record: d, ttl: 14400},
+		}
+	}
+	for _, d := range a.SubDomains {
+		if zone := s.zoneOf(d); zone != "" {
+			s.zones[zone] = append(s.zones[zone], &zoneRecord{name: d + ".", rrType: "A", record: "192.0.2.1", ttl: 14400})
+		}
+	}
+	return s
+}
+
+// zoneOf returns the zone of the account that name belongs to
+func (a *accountState) zoneOf(name string) string {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	for {
+		if _, ok := a.zones[name]; ok {
+			return name
+		}
+		i := strings.Index(name, ".")
+		if i < 0 {
+			return ""
+		}
+		name = name[i+1:]
+	}
+}
+
+func (a *accountState) summary() map[string]interface{} {
+	suspended := 0
+	if a.Suspended {
+		suspended = 1
+	}
+	return map[string]interface{}{
+		"user":      a.User,
+		"domain":    a.MainDomain,
+		"email":     a.Email,
+		"suspended": suspended,
+	}
+}
+
+func (a *accountState) documentRoot(domain string) string {
+	for _, d := range a.AddonDomains {
+		if d == domain {
+			return "/home/" + a.User + "/" + d
+		}
+	}
+	for _, d := range a.SubDomains {
+		if d == domain {
+			return "/home/" + a.User + "/public_html/" + d
+		}
+	}
+	return "/home/" + a.User + "/public_html"
+}
+
+func (a *accountState) domain(d string) map[string]interface{} {
+	return map[string]interface{}{
+		"domain":       d,
+		"ip":           "192.0.2.1",
+		"documentroot": a.documentRoot(d),
+		"user":         a.User,
+		"serveralias":  "www." + d,
+		"servername":   d,
+	}
+}
+
+// vhost returns the virtual host serving domain, parked domains being served by the
+// main domain
+func (a *accountState) vhost(domain string) string {
+	domain = strings.TrimPrefix(strings.ToLower(domain), "www.")
+	for _, d := range a.ParkedDomains {
+		if d == domain {
+			return a.MainDomain
+		}
+	}
+	for _, d := range append([]string{a.MainDomain}, append(a.AddonDomains, a.SubDomains...)...) {
+		if d == domain {
+			return d
+		}
+	}
+	return ""
+}
+
+// fqdns returns the names served by a virtual host
+func (a *accountState) fqdns(vhost string) []string {
+	names := []string{vhost, "www." + vhost}
+	if vhost == a.MainDomain {
+		for _, d := range a.ParkedDomains {
+			names = append(names, d, "www."+d)
+		}
+	}
+	return names
+}
+
+// uapiBatch runs the commands of Batch::strict, each a JSON array of module,
+// function and arguments, stopping at the first which fails
+func (s *Server) uapiBatch(user string, form url.Values) interface{} {
+	results := []interface{}{}
+	for _, command := range form["command"] {
+		var cmd []json.RawMessage
+		var module, function string
+		args := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(command), &cmd); err != nil || len(cmd) < 2 {
+			return uapiError("Invalid batch command: %s", command)
+		}
+		json.Unmarshal(cmd[0], &module)
+		json.Unmarshal(cmd[1], &function)
+		if len(cmd) > 2 {
+			json.Unmarshal(cmd[2], &args)
+		}
+
+		vals := url.Values{}
+		for name, v := range args {
+			switch v := v.(type) {
+			case []interface{}:
+				for _, vv := range v {
+					vals.Add(name, fmt.Sprint(vv))
+				}
+			default:
+				vals.Add(name, fmt.Sprint(v))
+			}
+		}
+
+		result := s.uapi(user, module, function, vals)
+		results = append(results, result)
+		if r, ok := result.(map[string]interface{}); ok && r["status"] != 1 {
+			failed := uapiError("%s::%s failed", module, function)
+			failed["data"] = results
+			return failed
+		}
+	}
+	return uapiResult(results)
+}
+
+func uapiResult(data interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"status":   1,
+		"data":     data,
+		"errors":   nil,
+		"messages": nil,
+		"warnings": nil,
+		"metadata": map[string]interface{}{},
+	}
+}
+
+func uapiError(format string, args ...interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"status":   0,
+		"data":     nil,
+		"errors":   []string{fmt.Sprintf(format, args...)},
+		"messages": nil,
+		"warnings": nil,
+		"metadata": map[string]interface{}{},
+	}
+}
+
+func (s *Server) uapi(user, module, function string, form url.Values) interface{} {
+	if module == "Batch" && function == "strict" {
+		return s.uapiBatch(user, form)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a := s.accounts[user]
+	switch module + "::" + function {
+	case "DomainInfo::domains_data":
+		addons, subs := []interface{}{}, []interface{}{}
+		for _, d := range a.AddonDomains {
+			addons = append(addons, a.domain(d))
+		}
+		for _, d := range a.SubDomains {
+			subs = append(subs, a.domain(d))
+		}
+		parked := append([]string{}, a.ParkedDomains...)
+		return uapiResult(map[string]interface{}{
+			"main_domain":    a.domain(a.MainDomain),
+			"addon_domains":  addons,
+			"parked_domains": parked,
+			"sub_domains":    subs,
+		})
+	case "DomainInfo::single_domain_data":
+		d := form.Get("domain")
+		if a.vhost(d) == "" {
+			return uapiError("You do not have access to a domain named “%s”.", d)
+		}
+		return uapiResult(a.domain(d))
+	case "NVData::get":
+		data := []interface{}{}
+		for _, name := range strings.Split(form.Get("names"), "|") {
+			if v, ok := a.nvdata[name]; ok {
+				data = append(data, map[string]string{"name": name, "value": v})
+			}
+		}
+		return uapiResult(data)
+	case "NVData::set":
+		data := []interface{}{}
+		for _, name := range strings.Split(form.Get("names"), "|") {
+			a.nvdata[name] = form.Get(name)
+			data = append(data, map[string]string{"set": name})
+		}
+		return uapiResult(data)
+	case "SSL::list_keys":
+		data := []interface{}{}
+		for _, k := range a.keys {
+			data = append(data, k.info(false))
+		}
+		return uapiResult(data)
+	case "SSL::generate_key":
+		bits, _ := strconv.Atoi(form.Get("key_size"))
+		if bits == 0 {
+			bits = 2048
+		}
+		pk, err := rsa.GenerateKey(rand.Reader, bits)
+		if err != nil {
+			return uapiError("%v", err)
+		}
+		text := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(pk)}))
+		k := s.addKey(a, text, form.Get("friendly_name"))
+		return uapiResult(k.info(true))
+	case "SSL::delete_key":
+		for i, k := range a.keys {
+			if k.id == form.Get("id") {
+				a.keys = append(a.keys[:i], a.keys[i+1:]...)
+				return uapiResult(nil)
+			}
+		}
+		return uapiError("The key “%s” does not exist.", form.Get("id"))
+	case "SSL::list_certs":
+		data := []interface{}{}
+		for _, c := range a.certs {
+			data = append(data, c.info())
+		}
+		return uapiResult(data)
+	case "SSL::delete_cert":
+		for i, c := range a.certs {
+			if c.id == form.Get("id") {
+				a.certs = append(a.certs[:i], a.certs[i+1:]...)
+				return uapiResult(nil)
+			}
+		}
+		return uapiError("The certificate “%s” does not exist.", form.Get("id"))
+	case "SSL::installed_hosts":
+		vhosts := make([]string, 0, len(a.installed))
+		for vhost := range a.installed {
+			vhosts = append(vhosts, vhost)
+		}
+		sort.Strings(vhosts)
+
+		data := []interface{}{}
+		for _, vhost := range vhosts {
+			c := a.installed[vhost]
+			data = append(data, map[string]interface{}{
+				"certificate":      c.info(),
+				"certificate_text": c.text,
+				"fqdns":            a.fqdns(vhost),
+				"servername":       vhost,
+			})
+		}
+		return uapiResult(data)
+	case "SSL::install_ssl":
+		return s.installSSL(a, form)
+	case "SSL::delete_ssl":
+		vhost := a.vhost(form.Get("domain"))
+		if _, ok := a.installed[vhost]; !ok {
+			return uapiError("The domain “%s” does not have an SSL certificate installed.", form.Get("domain"))
+		}
+		delete(a.installed, vhost)
+		return uapiResult(nil)
+	}
+	return uapiError("Failed to load module “%s”: Could not find function “%s”.", module, function)
+}
+
+func (s *Server) addKey(a *accountState, text, friendlyName string) *sslKey {
+	pk, err := parseKey(text)
+	if err != nil {
+		return nil
+	}
+	for _, k := range a.keys {
+		if k.modulus == modulus(&pk.PublicKey) {
+			return k
+		}
+	}
+
+	s.nextID++
+	k := &sslKey{
+		id:           fmt.Sprintf("%s_%s", strings.ToLower(modulus(&pk.PublicKey)[:5]), strconv.Itoa(s.nextID)),
+		friendlyName: friendlyName,
+		text:         text,
+		modulus:      modulus(&pk.PublicKey),
+		bits:         pk.N.BitLen(),
+		created:      time.Now().Unix(),
+	}
+	if k.friendlyName == "" {
+		k.friendlyName = k.id
+	}
+	a.keys = append(a.keys, k)
+	return k
+}
+
+func (k *sslKey) info(withText bool) map[string]interface{} {
+	info := map[string]interface{}{
+		"id":             k.id,
+		"friendly_name":  k.friendlyName,
+		"modulus":        k.modulus,
+		"modulus_length": k.bits,
+		"created":        strconv.FormatInt(k.created, 10),
+	}
+	if withText {
+		info["text"] = k.text
+	}
+	return info
+}
+
+func (c *sslCert) info() map[string]interface{} {
+	selfSigned := 0
+	if bytes.Equal(c.cert.RawIssuer, c.cert.RawSubject) && c.cert.CheckSignatureFrom(c.cert) == nil {
+		selfSigned = 1
+	}
+	var org string
+	if len(c.cert.Issuer.Organization) > 0 {
+		org = c.cert.Issuer.Organization[0]
+	}
+	return map[string]interface{}{
+		"id":                      c.id,
+		"domains":                 certDomains(c.cert),
+		"subject.commonName":      c.cert.Subject.CommonName,
+		"issuer.organizationName": org,
+		"not_after":               strconv.FormatInt(c.cert.NotAfter.Unix(), 10),
+		"is_self_signed":          selfSigned,
+		"modulus":                 c.modulus,
+	}
+}
+
+func (s *Server) installSSL(a *accountState, form url.Values) interface{} {
+	domain := form.Get("domain")
+	vhost := a.vhost(domain)
+	if vhost == "" {
+		return uapiError("You do not have access to a domain named “%s”.", domain)
+	}
+
+	block, _ := pem.Decode([]byte(form.Get("cert")))
+	if block == nil {
+		return uapiError("The certificate is not valid PEM.")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return uapiError("The certificate could not be parsed: %v", err)
+	}
+	pub, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return uapiError("Only RSA certificates are supported.")
+	}
+
+	k := s.addKey(a, form.Get("key"), "")
+	if k == nil {
+		return uapiError("The key could not be parsed.")
+	}
+	if k.modulus != modulus(pub) {
+		return uapiError("The certificate does not match the key.")
+	}
+
+	var c *sslCert
+	for _, v := range a.certs {
+		if bytes.Equal(v.cert.Raw, cert.Raw) {
+			c = v
+		}
+	}
+	if c == nil {
+		c = &sslCert{
+			id:      fmt.Sprintf("%s_%s_%d", strings.Replace(cert.Subject.CommonName, ".", "_", -1), strings.ToLower(k.modulus[:5]), cert.NotAfter.Unix()),
+			text:    form.Get("cert"),
+			cert:    cert,
+			modulus: k.modulus,
+		}
+		a.certs = append(a.certs, c)
+	}
+	a.installed[vhost] = c
+
+	working, warning := []string{}, []string{}
+	for _, name := range a.fqdns(vhost) {
+		if cert.VerifyHostname(name) == nil {
+			working = append(working, name)
+		} else {
+			warning = append(warning, name)
+		}
+	}
+
+	message := fmt.Sprintf("The SSL certificate is now installed onto the domain “%s”", vhost)
+	return uapiResult(map[string]interface{}{
+		"action":                    "install",
+		"cert_id":                   c.id,
+		"key_id":                    k.id,
+		"domain":                    vhost,
+		"ip":                        "192.0.2.1",
+		"user":                      a.User,
+		"message":                   message,
+		"statusmsg":                 message,
+		"html":                      message,
+		"working_domains":           working,
+		"warning_domains":           warning,
+		"extra_certificate_domains": []string{},
+	})
+}
+
+func certDomains(cert *x509.Certificate) []string {
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames
+	}
+	return []string{cert.Subject.CommonName}
+}
+
+func modulus(pub *rsa.PublicKey) string {
+	return fmt.Sprintf("%x", pub.N)
+}
+
+func parseKey(text string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(text))
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data")
+	}
+	if pk, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return pk, nil
+	}
+	pk, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := pk.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+func api2Result(module, function string, data interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"apiversion": 2,
+		"module":     module,
+		"func":       function,
+		"data":       data,
+		"event":      map[string]interface{}{"result": 1},
+	}
+}
+
+func api2Error(module, function, format string, args ...interface{}) map[string]interface{} {
+	reason := fmt.Sprintf(format, args...)
+	return map[string]interface{}{
+		"apiversion": 2,
+		"module":     module,
+		"func":       function,
+		"data":       nil,
+		"error":      reason,
+		"event":      map[string]interface{}{"result": 0, "reason": reason},
+	}
+}
+
+func (s *Server) api2(user, module, function string, form url.Values) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a := s.accounts[user]
+	zoneResult := func(status int, message string) interface{} {
+		return api2Result(module, function, []interface{}{
+			map[string]interface{}{"result": map[string]interface{}{"status": status, "statusmsg": message}},
+		})
+	}
+
+	switch module + "::" + function {
+	case "ZoneEdit::fetchzones":
+		zones := map[string][]string{}
+		for zone, records := range a.zones {
+			for _, r := range records {
+				if !r.deleted {
+					zones[zone] = append(zones[zone], fmt.Sprintf("%s\t%d\tIN\t%s\t%s", r.name, r.ttl, r.rrType, r.record))
+				}
+			}
+		}
+		return api2Result(module, function, []interface{}{
+			map[string]interface{}{"status": 1, "statusmsg": "Zones Fetched", "zones": zones},
+		})
+	case "ZoneEdit::fetchzone":
+		records, ok := a.zones[form.Get("domain")]
+		if !ok {
+			return api2Error(module, function, "You do not have access to the domain “%s”.", form.Get("domain"))
+		}
+		types := map[string]bool{}
+		for _, t := range strings.Split(form.Get("type"), ",") {
+			if t != "" {
+				types[strings.ToUpper(t)] = true
+			}
+		}
+
+		out := []interface{}{}
+		for i, r := range records {
+			if r.deleted || len(types) > 0 && !types[r.rrType] {
+				continue
+			}
+			rec := map[string]interface{}{
+				"line":   i + 1,
+				"name":   r.name,
+				"type":   r.rrType,
+				"record": r.record,
+				"ttl":    r.ttl,
+				"class":  "IN",
+			}
+			switch r.rrType {
+			case "A", "AAAA":
+				rec["address"] = r.record
+			case "TXT":
+				rec["txtdata"] = r.record
+			case "CNAME":
+				rec["cname"] = r.record
+			}
+			out = append(out, rec)
+		}
+		return api2Result(module, function, []interface{}{
+			map[string]interface{}{"record": out, "status": 1, "statusmsg": "Zone Serialized"},
+		})
+	case "ZoneEdit::add_zone_record":
+		zone := form.Get("domain")
+		if _, ok := a.zones[zone]; !ok {
+			return zoneResult(0, fmt.Sprintf("You do not have access to the domain “%s”.", zone))
+		}
+		rrType := strings.ToUpper(form.Get("type"))
+		record := form.Get("address")
+		switch rrType {
+		case "TXT":
+			record = form.Get("txtdata")
+		case "CNAME":
+			record = form.Get("cname")
+		}
+		ttl, _ := strconv.Atoi(form.Get("ttl"))
+		if ttl == 0 {
+			ttl = 14400
+		}
+		a.zones[zone] = append(a.zones[zone], &zoneRecord{
+			name:   absoluteName(form.Get("name"), zone),
+			rrType: rrType,
+			record: record,
+			ttl:    ttl,
+		})
+		return zoneResult(1, "Bind reloading on localhost using rndc zone: ["+zone+"]")
+	case "ZoneEdit::edit_zone_record", "ZoneEdit::remove_zone_record":
+		zone := form.Get("domain")
+		line, _ := strconv.Atoi(form.Get("line"))
+		records := a.zones[zone]
+		if line < 1 || line > len(records) || records[line-1].deleted {
+			return zoneResult(0, fmt.Sprintf("No record on line %d of “%s”.", line, zone))
+		}
+		r := records[line-1]
+		if function == "remove_zone_record" {
+			r.deleted = true
+		} else {
+			if v := form.Get("txtdata"); v != "" {
+				r.record = v
+			}
+			if v := form.Get("address"); v != "" {
+				r.record = v
+			}
+			if ttl, err := strconv.Atoi(form.Get("ttl")); err == nil {
+				r.ttl = ttl
+			}
+		}
+		return zoneResult(1, "Bind reloading on localhost using rndc zone: ["+zone+"]")
+	case "Park::listparkeddomains":
+		data := []interface{}{}
+		for _, d := range a.ParkedDomains {
+			data = append(data, map[string]string{"domain": d, "status": "not redirected", "dir": a.documentRoot(d)})
+		}
+		return api2Result(module, function, data)
+	}
+	return api2Error(module, function, "Could not find function “%s” in module “%s”", function, module)
+}
+
+// absoluteName returns name with a trailing dot, qualifying relative names with zone
+func absoluteName(name, zone string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	if name == zone || strings.HasSuffix(name, "."+zone) {
+		return name + "."
+	}
+	return name + "." + zone + "."
+}
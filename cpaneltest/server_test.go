@@ -0,0 +1,328 @@
+package cpaneltest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt-cpanel/cpanelgo"
+	"github.com/letsencrypt-cpanel/cpanelgo/cpanel"
+	"github.com/letsencrypt-cpanel/cpanelgo/whm"
+)
+
+const testTotpSecret = "JBSWY3DPEHPK3PXP"
+
+func newTestServer() *Server {
+	s := NewServer()
+	s.AddAccount(Account{
+		User:          "bob",
+		Password:      "hunter2",
+		TotpSecret:    testTotpSecret,
+		Email:         "bob@example.com",
+		MainDomain:    "example.com",
+		AddonDomains:  []string{"addon.com"},
+		ParkedDomains: []string{"parked.com"},
+		SubDomains:    []string{"sub.example.com"},
+	})
+	return s
+}
+
+func TestServerCpanel(t *testing.T) {
+	s := newTestServer()
+	defer s.Close()
+	api := s.CpanelApi("bob", "hunter2")
+
+	domains, err := api.DomainsData()
+	if err != nil || len(domains.DomainList()) != 4 {
+		t.Fatalf("unexpected domains: %+v, %v", domains, err)
+	}
+
+	cert, key, err := NewCertificate(time.Now().Add(90*24*time.Hour), "example.com", "www.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	installed, err := api.InstallSSLKey("example.com", cert, key, "")
+	if err != nil || installed.Data.CertId == "" || len(installed.Data.WarningDomains) != 2 {
+		t.Fatalf("unexpected install result: %+v, %v", installed.Data, err)
+	}
+	hosts, err := api.InstalledHosts()
+	if c, ok := hosts.GetCertificateForDomain("www.example.com"); err != nil || !ok || c.Id != installed.Data.CertId {
+		t.Errorf("certificate not installed: %+v, %v", hosts, err)
+	}
+	if _, err := api.InstallSSLKey("other.com", cert, key, ""); err == nil {
+		t.Error("expected an error installing onto a foreign domain")
+	}
+
+	if _, err := api.SetNVData("settings", map[string]int{"a": 1}); err != nil {
+		t.Fatal(err)
+	}
+	nv, err := api.GetNVData("settings")
+	if err != nil || len(nv.Data) != 1 || nv.Data[0].FileContents != `{"a":1}` {
+		t.Errorf("unexpected NVData: %+v, %v", nv, err)
+	}
+
+	if err := api.AddZoneTextRecord("example.com", "_acme-challenge", "token", "300"); err != nil {
+		t.Fatal(err)
+	}
+	zone, err := api.FetchZone("example.com", "TXT")
+	found, lines := zone.Find("_acme-challenge.example.com.", "TXT")
+	if err != nil || !found {
+		t.Fatalf("record not added: %+v, %v", zone, err)
+	}
+	if err := api.EditZoneTextRecord(lines[0], "example.com", "other", "300"); err != nil {
+		t.Fatal(err)
+	}
+	zone, _ = api.FetchZone("example.com", "TXT")
+	if zone.Data[0].Records[0].Record != "other" {
+		t.Errorf("record not edited: %+v", zone.Data[0].Records)
+	}
+	zones, err := api.FetchZones()
+	if err != nil || zones.FindRootForName("_acme-challenge.sub.example.com") != "example.com" {
+		t.Errorf("unexpected zones: %+v, %v", zones, err)
+	}
+}
+
+func TestServerAuthentication(t *testing.T) {
+	s := newTestServer()
+	defer s.Close()
+
+	_, err := s.CpanelApi("bob", "wrong").DomainsData()
+	var apiErr *cpanelgo.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 401 {
+		t.Errorf("expected 401, got: %v", err)
+	}
+
+	session, _ := cpanel.NewJsonApiSession("localhost", "bob", "hunter2", testTotpSecret, true)
+	e := s.CpanelEndpoint()
+	session.Gateway.(*cpanel.JsonApiGateway).Endpoint = &e
+	if _, err := session.DomainsData(); err != nil {
+		t.Errorf("unexpected error with session: %v", err)
+	}
+
+	session, _ = cpanel.NewJsonApiSession("localhost", "bob", "hunter2", "", true)
+	session.Gateway.(*cpanel.JsonApiGateway).Endpoint = &e
+	if _, err := session.DomainsData(); !errors.Is(err, cpanelgo.ErrLoginFailed) {
+		t.Errorf("expected login without one-time password to fail, got: %v", err)
+	}
+
+	s.WhmTotpSecret = testTotpSecret
+	if _, err := s.WhmApi().Version(); !errors.As(err, &apiErr) || apiErr.StatusCode != 403 {
+		t.Errorf("expected 403 without one-time password, got: %v", err)
+	}
+	api := whm.NewWhmApiTokenTotp("localhost", "root", "WHMTOKEN", true, testTotpSecret).WithEndpoint(s.WhmEndpoint())
+	if _, err := api.Version(); err != nil {
+		t.Errorf("unexpected error with one-time password: %v", err)
+	}
+}
+
+func TestServerWhm(t *testing.T) {
+	s := newTestServer()
+	defer s.Close()
+	api := s.WhmApi()
+
+	accounts, err := api.ListAccounts()
+	if err != nil || len(accounts.Data.Accounts) != 1 || accounts.Data.Accounts[0].User != "bob" {
+		t.Errorf("unexpected accounts: %+v, %v", accounts, err)
+	}
+	summary, err := api.AccountSummary("bob")
+	if err != nil || summary.Email() != "bob@example.com" || summary.Suspended() {
+		t.Errorf("unexpected summary: %+v, %v", summary, err)
+	}
+	if _, err := api.AccountSummary("alice"); err == nil {
+		t.Error("expected an error for an unknown account")
+	}
+
+	impersonated := s.ImpersonationApi("bob")
+	if err := impersonated.AddZoneTextRecord("addon.com", "_acme-challenge", "token", "300"); err != nil {
+		t.Fatal(err)
+	}
+	zone, err := impersonated.FetchZone("addon.com", "TXT")
+	if found, _ := zone.Find("_acme-challenge.addon.com.", "TXT"); err != nil || !found {
+		t.Errorf("record not added: %+v, %v", zone, err)
+	}
+	domains, err := impersonated.DomainsData()
+	if err != nil || domains.Data.MainDomain.Domain != "example.com" {
+		t.Errorf("unexpected domains: %+v, %v", domains, err)
+	}
+}
+
+func TestServerWhmPagination(t *testing.T) {
+	s := newTestServer()
+	defer s.Close()
+	for _, user := range []string{"erin", "alice", "dave", "carol"} {
+		s.AddAccount(Account{User: user, MainDomain: user + ".example.com"})
+	}
+	api := s.WhmApi()
+
+	var users []string
+	it := cpanelgo.NewPageIterator(cpanelgo.Query{PageSize: 2}, func(ctx context.Context, q cpanelgo.Query) (cpanelgo.Paginated, error) {
+		return api.ListAccountsQueryContext(ctx, q)
+	})
+	pages := 0
+	for it.Next(context.Background()) {
+		pages++
+		for _, a := range it.Response().(whm.ListAccountsApiResponse).Data.Accounts {
+			users = append(users, a.User)
+		}
+	}
+	if it.Err() != nil || pages != 3 || strings.Join(users, ",") != "alice,bob,carol,dave,erin" {
+		t.Errorf("unexpected pages: %d, %v, %v", pages, users, it.Err())
+	}
+
+	accounts, err := api.ListAccountsQuery(cpanelgo.Query{PageSize: 2, Page: 3})
+	if p, ok := accounts.Pagination(); err != nil || !ok || p.TotalResults != 5 || p.CurrentPage != 3 || len(accounts.Data.Accounts) != 1 {
+		t.Errorf("unexpected last page: %+v, %+v, %v", accounts, p, err)
+	}
+}
+
+func TestServerBatch(t *testing.T) {
+	s := newTestServer()
+	defer s.Close()
+
+	ls, err := NewLiveServer(NewFake().
+		Respond(UAPI, "DomainInfo", "domains_data", DomainsData("bob", "example.com", []string{"addon.com"}, []string{"parked.com"}, []string{"sub.example.com"})).
+		Respond(UAPI, "SSL", "installed_hosts", InstalledHosts()).
+		Respond(UAPI, "DomainInfo", "single_domain_data", UAPIError("No such domain: other.com")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ls.Close()
+	live, err := cpanel.NewLiveApi("unix", ls.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer live.Close()
+	// a gateway failing every call whose status is not 1, after decoding it
+	live.Gateway.(*cpanel.LiveApiGateway).Interceptors = cpanelgo.Interceptors{
+		func(ctx context.Context, call *cpanelgo.Call, out interface{}, invoke cpanelgo.Invoker) error {
+			if err := invoke(ctx, call, out); err != nil {
+				return err
+			}
+			return cpanelgo.ResponseError(out)
+		},
+	}
+
+	for name, api := range map[string]cpanel.CpanelApi{
+		"cpanel":        s.CpanelApi("bob", "hunter2"),
+		"impersonation": s.ImpersonationApi("bob"),
+		"live":          live,
+	} {
+		var domains, more cpanel.DomainsDataApiResponse
+		var hosts cpanel.InstalledHostsApiResponse
+		var single cpanelgo.BaseUAPIResponse
+
+		b := api.NewBatch()
+		domainsCall := b.DomainsData(&domains)
+		hostsCall := b.InstalledHosts(&hosts)
+		failed := b.Add("DomainInfo", "single_domain_data", cpanelgo.Args{"domain": "other.com"}, &single)
+		notRun := b.DomainsData(&more)
+
+		err := b.Do()
+		if err == nil || err != failed.Err() {
+			t.Errorf("%s: expected the error of the failed call, got: %v", name, err)
+		}
+		if domainsCall.Err() != nil || len(domains.DomainList()) != 4 || len(domains.Data.Subdomains) != 1 {
+			t.Errorf("%s: unexpected domains: %+v, %v", name, domains, domainsCall.Err())
+		}
+		if hostsCall.Err() != nil || hosts.StatusCode != 1 {
+			t.Errorf("%s: unexpected hosts: %+v, %v", name, hosts, hostsCall.Err())
+		}
+		var apiErr *cpanelgo.APIError
+		if !errors.As(failed.Err(), &apiErr) || apiErr.Function != "single_domain_data" || !apiErr.HasError("other.com") {
+			t.Errorf("%s: unexpected error: %v", name, failed.Err())
+		}
+		if notRun.Err() != cpanelgo.ErrBatchNotRun || !notRun.Done() {
+			t.Errorf("%s: expected %v, got: %v", name, cpanelgo.ErrBatchNotRun, notRun.Err())
+		}
+	}
+
+	var accounts whm.ListAccountsApiResponse
+	var bob, nobody whm.AccountSummaryApiResponse
+	b := s.WhmApi().NewBatch()
+	accountsCall := b.ListAccounts(&accounts)
+	bobCall := b.AccountSummary("bob", &bob)
+	nobodyCall := b.AccountSummary("nobody", &nobody)
+	if err := b.Do(); err == nil || err != nobodyCall.Err() {
+		t.Errorf("expected the error of the failed call, got: %v", err)
+	}
+	if accountsCall.Err() != nil || len(accounts.Data.Accounts) != 1 {
+		t.Errorf("unexpected accounts: %+v, %v", accounts, accountsCall.Err())
+	}
+	if bobCall.Err() != nil || bob.Email() != "bob@example.com" {
+		t.Errorf("unexpected summary: %+v, %v", bob, bobCall.Err())
+	}
+	if err := nobodyCall.Err(); err == nil || !strings.Contains(err.Error(), "nobody") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestServerLimit(t *testing.T) {
+	s := newTestServer()
+	defer s.Close()
+
+	// both servers listen on 127.0.0.1, so all the clients share its limiter
+	cpanelgo.SetServerLimit(s.WhmEndpoint().Host, cpanelgo.Limit{MaxInFlight: 2})
+	defer cpanelgo.ResetServerLimit(s.WhmEndpoint().Host)
+
+	var mu sync.Mutex
+	var inFlight, peak int
+	count := func(cl *http.Client) {
+		next := cl.Transport
+		cl.Transport = RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+			mu.Lock()
+			if inFlight++; inFlight > peak {
+				peak = inFlight
+			}
+			mu.Unlock()
+			defer func() {
+				mu.Lock()
+				inFlight--
+				mu.Unlock()
+			}()
+			time.Sleep(5 * time.Millisecond)
+			return next.RoundTrip(req)
+		})
+	}
+	count(s.Cpanel.Client())
+	count(s.Whm.Client())
+
+	cpanelApi := s.CpanelApi("bob", "hunter2")
+	whmApi := s.WhmApi()
+	impersonated := s.ImpersonationApi("bob")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 30)
+	for i := 0; i < 10; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			_, err := cpanelApi.DomainsData()
+			errs <- err
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := whmApi.ListAccounts()
+			errs <- err
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := impersonated.DomainsData()
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if peak > 2 {
+		t.Errorf("%d requests in flight, expected at most 2", peak)
+	}
+}
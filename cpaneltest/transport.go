@@ -0,0 +1,30 @@
+package cpaneltest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// RoundTripFunc is an http.RoundTripper answering requests itself, to fake a server
+// at the HTTP level without listening:
+//
+//	cl := &http.Client{Transport: cpaneltest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+//		return cpaneltest.HTTPResponse(http.StatusOK, `{"status":1,"data":"paper_lantern"}`), nil
+//	})}
+//	api, _ := cpanel.NewJsonApiWithClient("example.com", "bob", "hunter2", false, cl)
+type RoundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f RoundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// HTTPResponse returns a response with status and body, for a RoundTripFunc.
+func HTTPResponse(status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Status:     http.StatusText(status),
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+	}
+}
@@ -0,0 +1,83 @@
+package cpanelgo
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	CpanelPort = 2083
+	WhmPort    = 2087
+)
+
+// Endpoint is the address at which a cPanel or WHM server is reached. Besides the
+// usual https://hostname:2083 (or 2087), this covers proxy subdomains such as
+// https://cpanel.example.com, which use the default port of the scheme, and reverse
+// proxies serving the API below a path prefix.
+type Endpoint struct {
+	// Defaults to "https"
+	Scheme string
+	// Hostname, IPv4 or IPv6 address. IPv6 addresses may be given with or without brackets.
+	Host string
+	// Zero leaves out the port, so the default port of the scheme is used
+	Port int
+	// Path below which the API is served, e.g. "/cpanel"
+	PathPrefix string
+}
+
+// ParseEndpoint parses an address such as "cpanel.example.com", "[2001:db8::1]:2083" or
+// "https://proxy.example.com/cpanel". Without a scheme, https is assumed.
+func ParseEndpoint(address string) (Endpoint, error) {
+	if !strings.Contains(address, "://") {
+		address = "https://" + address
+	}
+	u, err := url.Parse(address)
+	if err != nil {
+		return Endpoint{}, err
+	}
+	if u.Hostname() == "" {
+		return Endpoint{}, fmt.Errorf("no host in endpoint: %s", address)
+	}
+
+	e := Endpoint{
+		Scheme:     u.Scheme,
+		Host:       u.Hostname(),
+		PathPrefix: u.Path,
+	}
+	if p := u.Port(); p != "" {
+		if e.Port, err = strconv.Atoi(p); err != nil {
+			return Endpoint{}, fmt.Errorf("invalid port in endpoint: %s", address)
+		}
+	}
+	return e, nil
+}
+
+// URL returns the base URL of the endpoint, without a trailing slash
+// (e.g. "https://[2001:db8::1]:2083/cpanel")
+func (e Endpoint) URL() string {
+	scheme := e.Scheme
+	if scheme == "" {
+		scheme = "https"
+	}
+
+	host := strings.TrimSuffix(strings.TrimPrefix(e.Host, "["), "]")
+	if e.Port != 0 {
+		host = net.JoinHostPort(host, strconv.Itoa(e.Port))
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+
+	prefix := strings.Trim(e.PathPrefix, "/")
+	if prefix != "" {
+		prefix = "/" + prefix
+	}
+
+	return scheme + "://" + host + prefix
+}
+
+func (e Endpoint) String() string {
+	return e.URL()
+}
@@ -0,0 +1,45 @@
+package cpanelgo
+
+import "testing"
+
+func TestEndpointURL(t *testing.T) {
+	tests := []struct {
+		endpoint Endpoint
+		expected string
+	}{
+		{Endpoint{Host: "example.com", Port: CpanelPort}, "https://example.com:2083"},
+		{Endpoint{Host: "cpanel.example.com"}, "https://cpanel.example.com"},
+		{Endpoint{Scheme: "http", Host: "127.0.0.1", Port: 2082}, "http://127.0.0.1:2082"},
+		{Endpoint{Host: "2001:db8::1", Port: WhmPort}, "https://[2001:db8::1]:2087"},
+		{Endpoint{Host: "[2001:db8::1]"}, "https://[2001:db8::1]"},
+		{Endpoint{Host: "proxy.example.com", PathPrefix: "/cpanel/"}, "https://proxy.example.com/cpanel"},
+	}
+
+	for _, test := range tests {
+		if actual := test.endpoint.URL(); actual != test.expected {
+			t.Errorf("expected %s, got: %s", test.expected, actual)
+		}
+	}
+}
+
+func TestParseEndpoint(t *testing.T) {
+	tests := []struct {
+		address  string
+		expected Endpoint
+	}{
+		{"cpanel.example.com", Endpoint{Scheme: "https", Host: "cpanel.example.com"}},
+		{"[2001:db8::1]:2083", Endpoint{Scheme: "https", Host: "2001:db8::1", Port: 2083}},
+		{"http://proxy.example.com:8080/whm", Endpoint{Scheme: "http", Host: "proxy.example.com", Port: 8080, PathPrefix: "/whm"}},
+	}
+
+	for _, test := range tests {
+		actual, err := ParseEndpoint(test.address)
+		if err != nil || actual != test.expected {
+			t.Errorf("%s: unexpected result: %+v, %v", test.address, actual, err)
+		}
+	}
+
+	if _, err := ParseEndpoint("https://:2083"); err == nil {
+		t.Error("expected an error for an endpoint without host")
+	}
+}
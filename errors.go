@@ -0,0 +1,158 @@
+package cpanelgo
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	// Maximum number of bytes of the raw response body kept on an APIError
+	bodySnippetLength = 512
+)
+
+var (
+	// The server refused the API token, because it is unknown or was revoked
+	ErrTokenRejected = errors.New("API token rejected")
+	// The server refused the API token because it has expired. Telling it from
+	// ErrTokenRejected is best effort, see TokenAuthError.
+	ErrTokenExpired = errors.New("API token expired")
+)
+
+// APIError is returned when cPanel or WHM reports a failure, either through the HTTP
+// status of the response or in the response body itself. Use errors.As to inspect it.
+type APIError struct {
+	APIVersion string // "uapi", "2", "1" or "whmapi1"
+	Module     string // empty for WHM API 1
+	Function   string
+	StatusCode int // HTTP status code, 0 when not applicable (e.g. LiveAPI)
+	Errors     []string
+	Messages   []string
+	Warnings   []string
+	Body       string // beginning of the raw response body, if available
+	Err        error  // underlying cause, such as ErrTokenExpired
+}
+
+func (e *APIError) Error() string {
+	var msg string
+	switch {
+	case len(e.Errors) > 0:
+		msg = strings.Join(e.Errors, "\n")
+	case e.StatusCode >= 300:
+		msg = fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	default:
+		msg = ErrorUnknown
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// Unknown reports whether the API failed without saying why.
+func (e *APIError) Unknown() bool {
+	return len(e.Errors) == 0 && e.StatusCode < 300
+}
+
+// HasError reports whether any of the error messages contains substr.
+func (e *APIError) HasError(substr string) bool {
+	for _, v := range e.Errors {
+		if strings.Contains(v, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResponseInfo describes the call which produced a response.
+type ResponseInfo struct {
+	APIVersion string
+	Module     string
+	Function   string
+	StatusCode int
+	Body       []byte
+	// Warnings reported alongside the response rather than in it, such as the
+	// <error> elements LiveAPI wraps around the JSON
+	Warnings []string
+}
+
+// NewAPIError creates an APIError for the call described by info.
+func (info ResponseInfo) NewAPIError(errs, messages, warnings []string) *APIError {
+	if len(info.Warnings) > 0 {
+		warnings = append(append([]string(nil), warnings...), info.Warnings...)
+	}
+	body := info.Body
+	if len(body) > bodySnippetLength {
+		body = body[:bodySnippetLength]
+	}
+	return &APIError{
+		APIVersion: info.APIVersion,
+		Module:     info.Module,
+		Function:   info.Function,
+		StatusCode: info.StatusCode,
+		Errors:     errs,
+		Messages:   messages,
+		Warnings:   warnings,
+		Body:       string(body),
+	}
+}
+
+type responseInfoSetter interface {
+	setResponseInfo(info ResponseInfo)
+}
+
+// SetResponseInfo records the call that produced out, so that failures later
+// reported by out.Error() identify it. It does nothing unless out is a pointer to a
+// type embedding one of the base response types of this package.
+func SetResponseInfo(out interface{}, info ResponseInfo) {
+	if s, ok := out.(responseInfoSetter); ok {
+		s.setResponseInfo(info.Detached())
+	}
+}
+
+// Detached returns info with a copy of the start of its body, the part reported by
+// errors, so that a response keeping it does not pin the whole body in memory.
+func (info ResponseInfo) Detached() ResponseInfo {
+	if len(info.Body) > bodySnippetLength {
+		info.Body = info.Body[:bodySnippetLength]
+	}
+	info.Body = append([]byte(nil), info.Body...)
+	return info
+}
+
+// DecodeResult unmarshals raw, the result of a call carried inside another
+// response, into out and records info with raw as its body.
+func DecodeResult(raw json.RawMessage, out interface{}, info ResponseInfo) error {
+	if err := json.Unmarshal(raw, out); err != nil {
+		return err
+	}
+	info.Body = raw
+	SetResponseInfo(out, info)
+	return nil
+}
+
+// TokenAuthError classifies the failure of a request authenticated with an API token,
+// returning ErrTokenExpired or ErrTokenRejected, or nil if it was not an authentication
+// failure.
+//
+// cpsrvd answers an expired token with the same status as an unknown or revoked one,
+// and with a plain text or HTML body rather than a structured reason, so the two are
+// told apart on a best effort basis: a body mentioning "expired" is ErrTokenExpired,
+// anything else, including a change of wording across cPanel versions, is
+// ErrTokenRejected.
+func TokenAuthError(statusCode int, body []byte) error {
+	if statusCode != http.StatusUnauthorized && statusCode != http.StatusForbidden {
+		return nil
+	}
+	if bytes.Contains(bytes.ToLower(body), []byte("expired")) {
+		return ErrTokenExpired
+	}
+	return ErrTokenRejected
+}
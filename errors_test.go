@@ -0,0 +1,100 @@
+package cpanelgo
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestAPIError(t *testing.T) {
+	tests := []struct {
+		body     string
+		expected string
+		unknown  bool
+	}{
+		{`{"status":0,"errors":["first","second"],"warnings":["careful"]}`, "first\nsecond", false},
+		{`{"status":0,"errors":null}`, ErrorUnknown, true},
+		{`{"status":0,"error":"broken"}`, "broken", false},
+	}
+
+	for _, test := range tests {
+		var out struct {
+			BaseUAPIResponse
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(test.body), &out); err != nil {
+			t.Fatal(err)
+		}
+		SetResponseInfo(&out, ResponseInfo{
+			APIVersion: "uapi",
+			Module:     "SSL",
+			Function:   "install_ssl",
+			StatusCode: 200,
+			Body:       []byte(test.body),
+		})
+
+		err := out.Error()
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			t.Fatalf("expected an *APIError, got: %T", err)
+		}
+		if err.Error() != test.expected {
+			t.Errorf("expected error %q, got: %q", test.expected, err.Error())
+		}
+		if apiErr.Unknown() != test.unknown {
+			t.Errorf("%q: expected Unknown() %t", test.body, test.unknown)
+		}
+		if apiErr.Module != "SSL" || apiErr.Function != "install_ssl" || apiErr.Body != test.body {
+			t.Errorf("call not recorded on error: %+v", apiErr)
+		}
+	}
+}
+
+func TestAPIErrorStatus(t *testing.T) {
+	err := ResponseInfo{StatusCode: 503}.NewAPIError(nil, nil, nil)
+	if err.Error() != "503 Service Unavailable" {
+		t.Errorf("unexpected error: %q", err.Error())
+	}
+	if err.Unknown() {
+		t.Error("HTTP failure should not be reported as unknown")
+	}
+}
+
+func TestDecodeResult(t *testing.T) {
+	raw := json.RawMessage(`{"status":0,"errors":["` + strings.Repeat("x", 1000) + `"]}`)
+	var out BaseUAPIResponse
+	if err := DecodeResult(raw, &out, ResponseInfo{APIVersion: "uapi", Module: "Mod", Function: "func"}); err != nil {
+		t.Fatal(err)
+	}
+	var apiErr *APIError
+	if err := out.Error(); !errors.As(err, &apiErr) || apiErr.Function != "func" || len(apiErr.Body) != bodySnippetLength {
+		t.Errorf("unexpected error: %+v", apiErr)
+	}
+
+	raw[2] = '!'
+	if apiErr.Body[2] == '!' {
+		t.Error("response info shares the body")
+	}
+	if err := DecodeResult(json.RawMessage(`[`), &out, ResponseInfo{}); err == nil {
+		t.Error("expected an error for invalid JSON")
+	}
+}
+
+func TestResponseInfoUnset(t *testing.T) {
+	var out BaseAPI1Response
+	out.ErrorString = "broken"
+	if info := out.ResponseInfo(); info.Function != "" || info.Body != nil {
+		t.Errorf("unexpected info: %+v", info)
+	}
+	if err := out.Error(); err == nil || err.Error() != "broken" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// the base types stay comparable once the info is set
+	a, b := BaseResult{ErrorString: "x"}, BaseResult{ErrorString: "x"}
+	SetResponseInfo(&a, ResponseInfo{Function: "func", Body: []byte("{}")})
+	if a == b || a.ResponseInfo().Function != "func" {
+		t.Errorf("unexpected info: %+v", a.ResponseInfo())
+	}
+}
@@ -0,0 +1,48 @@
+package cpanelgo
+
+import (
+	"context"
+	"time"
+)
+
+// Call describes a single API call as it passes through the interceptors of a gateway.
+type Call struct {
+	APIVersion     string   // "uapi", "2", "1" or "whmapi1"
+	Module         string   // empty for WHM API 1
+	Function       string   //
+	Args           Args     // named arguments, used by all but API1
+	PositionalArgs []string // API1 arguments
+	ResponseSize   int64    // number of bytes read from the server, set by the gateway
+}
+
+// Invoker performs call and decodes the response into out.
+type Invoker func(ctx context.Context, call *Call, out interface{}) error
+
+// Interceptor runs around every call made by a gateway. It may inspect or rewrite
+// call before passing it on to invoke, inspect the outcome afterwards, or answer the
+// call itself without invoking the rest of the chain at all.
+type Interceptor func(ctx context.Context, call *Call, out interface{}, invoke Invoker) error
+
+// Interceptors is a chain of interceptors, the first of which is outermost.
+type Interceptors []Interceptor
+
+// Invoke runs call through the chain, with final performing the actual call.
+func (is Interceptors) Invoke(ctx context.Context, call *Call, out interface{}, final Invoker) error {
+	if len(is) == 0 {
+		return final(ctx, call, out)
+	}
+	return is[0](ctx, call, out, func(ctx context.Context, call *Call, out interface{}) error {
+		return is[1:].Invoke(ctx, call, out, final)
+	})
+}
+
+// Observe returns an interceptor which reports every completed call to fn, along with
+// how long it took and how it failed, if at all.
+func Observe(fn func(ctx context.Context, call *Call, duration time.Duration, err error)) Interceptor {
+	return func(ctx context.Context, call *Call, out interface{}, invoke Invoker) error {
+		start := time.Now()
+		err := invoke(ctx, call, out)
+		fn(ctx, call, time.Since(start), err)
+		return err
+	}
+}
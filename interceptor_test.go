@@ -0,0 +1,51 @@
+package cpanelgo
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestInterceptors(t *testing.T) {
+	var order []string
+	trace := func(name string) Interceptor {
+		return func(ctx context.Context, call *Call, out interface{}, invoke Invoker) error {
+			order = append(order, name)
+			return invoke(ctx, call, out)
+		}
+	}
+	rewrite := func(ctx context.Context, call *Call, out interface{}, invoke Invoker) error {
+		call.Args = Args{"rewritten": 1}
+		return invoke(ctx, call, out)
+	}
+
+	var observed *Call
+	var observedErr error
+	observe := Observe(func(ctx context.Context, call *Call, d time.Duration, err error) {
+		observed, observedErr = call, err
+	})
+
+	failure := errors.New("failed")
+	final := func(ctx context.Context, call *Call, out interface{}) error {
+		order = append(order, "final")
+		if _, ok := call.Args["rewritten"]; !ok {
+			t.Error("arguments were not rewritten")
+		}
+		call.ResponseSize = 42
+		return failure
+	}
+
+	chain := Interceptors{trace("outer"), observe, rewrite, trace("inner")}
+	err := chain.Invoke(context.Background(), &Call{APIVersion: "uapi", Module: "SSL", Function: "list_certs"}, nil, final)
+	if err != failure || observedErr != failure {
+		t.Errorf("error not passed back through the chain: %v, %v", err, observedErr)
+	}
+	if expected := []string{"outer", "inner", "final"}; !reflect.DeepEqual(order, expected) {
+		t.Errorf("expected order %v, got: %v", expected, order)
+	}
+	if observed == nil || observed.Function != "list_certs" || observed.ResponseSize != 42 {
+		t.Errorf("unexpected observed call: %+v", observed)
+	}
+}
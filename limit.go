@@ -0,0 +1,233 @@
+package cpanelgo
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit caps the requests sent to a server, so that fanning out over many accounts
+// does not get the client throttled or blocked by cPHulk.
+type Limit struct {
+	// Requests started per second, zero means no limit
+	RequestsPerSecond float64
+	// Requests which may start at once after an idle period, defaults to 1
+	Burst int
+	// Requests in flight at once, zero means no limit
+	MaxInFlight int
+}
+
+// Limiter enforces a Limit across all the gateways sharing it. It is safe for
+// concurrent use, and a nil Limiter does not limit anything.
+type Limiter struct {
+	mu       sync.Mutex
+	limit    Limit
+	tokens   float64
+	last     time.Time
+	inFlight int
+	// closed and replaced whenever a request finishes or the limit changes
+	wake chan struct{}
+}
+
+// NewLimiter returns a limiter enforcing l.
+func NewLimiter(l Limit) *Limiter {
+	return &Limiter{limit: l, wake: make(chan struct{})}
+}
+
+// Limit returns the limit enforced.
+func (l *Limiter) Limit() Limit {
+	if l == nil {
+		return Limit{}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// SetLimit changes the limit enforced, including for the requests already waiting.
+// It does nothing on a nil Limiter, which never limits.
+func (l *Limiter) SetLimit(limit Limit) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = limit
+	l.notify()
+}
+
+// Acquire waits until a request may start, or until ctx is done. Once it succeeds,
+// the request counts as in flight until release is called.
+func (l *Limiter) Acquire(ctx context.Context) (release func(), err error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	for {
+		l.mu.Lock()
+		wait, ok := l.reserve(time.Now())
+		wake := l.wake
+		l.mu.Unlock()
+		if ok {
+			var once sync.Once
+			return func() { once.Do(l.release) }, nil
+		}
+
+		var timer *time.Timer
+		var expired <-chan time.Time
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			expired = timer.C
+		}
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return nil, ctx.Err()
+		case <-wake:
+		case <-expired:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// reserve takes a slot and a token if both are available, otherwise it returns how
+// long until the next token, zero if waiting for a slot. Called with mu held.
+func (l *Limiter) reserve(now time.Time) (time.Duration, bool) {
+	if l.limit.MaxInFlight > 0 && l.inFlight >= l.limit.MaxInFlight {
+		return 0, false
+	}
+
+	if rate := l.limit.RequestsPerSecond; rate > 0 {
+		burst := float64(l.limit.Burst)
+		if burst < 1 {
+			burst = 1
+		}
+		if l.last.IsZero() {
+			l.tokens = burst
+		} else if l.tokens += now.Sub(l.last).Seconds() * rate; l.tokens > burst {
+			l.tokens = burst
+		}
+		l.last = now
+		if l.tokens < 1 {
+			return time.Duration((1 - l.tokens) / rate * float64(time.Second)), false
+		}
+		l.tokens--
+	}
+
+	l.inFlight++
+	return 0, true
+}
+
+func (l *Limiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	l.notify()
+}
+
+// notify wakes the requests waiting. Called with mu held.
+func (l *Limiter) notify() {
+	close(l.wake)
+	l.wake = make(chan struct{})
+}
+
+// ReleaseOnClose calls release once the body of resp is closed, so that a request
+// stays in flight until its response was read.
+func ReleaseOnClose(resp *http.Response, release func()) {
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+}
+
+type releasingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+var (
+	serverLimitersMu sync.Mutex
+	serverLimiters   = map[string]*Limiter{}
+	// hosts whose limit was set with SetServerLimit
+	serverLimitsSet    = map[string]bool{}
+	defaultServerLimit Limit
+)
+
+// ServerLimiter returns the limiter used by gateways to host which were not given
+// their own, e.g. by every JsonApiGateway, WhmApi and impersonation client of the
+// same server. The cPanel and WHM ports of a host share it, as they are served by
+// the same cpsrvd.
+func ServerLimiter(host string) *Limiter {
+	host = limiterKey(host)
+
+	serverLimitersMu.Lock()
+	defer serverLimitersMu.Unlock()
+
+	l, ok := serverLimiters[host]
+	if !ok {
+		l = NewLimiter(defaultServerLimit)
+		serverLimiters[host] = l
+	}
+	return l
+}
+
+// SetServerLimit sets the limit of the requests to host, which applies right away
+// to the gateways already created. It overrides the default limit, even when limit
+// is the zero Limit, until ResetServerLimit.
+func SetServerLimit(host string, limit Limit) {
+	l := ServerLimiter(host)
+
+	serverLimitersMu.Lock()
+	serverLimitsSet[limiterKey(host)] = true
+	serverLimitersMu.Unlock()
+
+	l.SetLimit(limit)
+}
+
+// ResetServerLimit makes the requests to host follow the default limit again, undoing
+// SetServerLimit.
+func ResetServerLimit(host string) {
+	l := ServerLimiter(host)
+
+	serverLimitersMu.Lock()
+	defer serverLimitersMu.Unlock()
+
+	delete(serverLimitsSet, limiterKey(host))
+	l.SetLimit(defaultServerLimit)
+}
+
+// SetDefaultServerLimit sets the limit of the requests to each server whose limit was
+// not set with SetServerLimit. There is no limit by default.
+func SetDefaultServerLimit(limit Limit) {
+	serverLimitersMu.Lock()
+	defer serverLimitersMu.Unlock()
+
+	defaultServerLimit = limit
+	for host, l := range serverLimiters {
+		if !serverLimitsSet[host] {
+			l.SetLimit(limit)
+		}
+	}
+}
+
+// limiterKey normalises host, which may carry a port, to its hostname
+func limiterKey(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimPrefix(host, "[")
+	host = strings.TrimSuffix(host, "]")
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
@@ -0,0 +1,140 @@
+package cpanelgo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLimiterMaxInFlight(t *testing.T) {
+	l := NewLimiter(Limit{MaxInFlight: 2})
+
+	first, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the third request to wait, got: %v", err)
+	}
+
+	acquired := make(chan error)
+	go func() {
+		_, err := l.Acquire(context.Background())
+		acquired <- err
+	}()
+	first()
+	first() // releasing twice frees a single slot
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("request not started after another finished")
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.Acquire(ctx); err == nil {
+		t.Error("a double release freed two slots")
+	}
+}
+
+func TestLimiterRate(t *testing.T) {
+	l := NewLimiter(Limit{RequestsPerSecond: 50, Burst: 2})
+
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		release, err := l.Acquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+	}
+	// the burst starts at once, the 4 others are 20ms apart
+	if elapsed := time.Since(start); elapsed < 70*time.Millisecond {
+		t.Errorf("6 requests at 50/s with a burst of 2 took only %v", elapsed)
+	}
+}
+
+func TestLimiterSetLimit(t *testing.T) {
+	l := NewLimiter(Limit{MaxInFlight: 1})
+	if _, err := l.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	acquired := make(chan error)
+	go func() {
+		_, err := l.Acquire(context.Background())
+		acquired <- err
+	}()
+	l.SetLimit(Limit{MaxInFlight: 2})
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiting request not started after the limit was raised")
+	}
+
+	var nilLimiter *Limiter
+	nilLimiter.SetLimit(Limit{MaxInFlight: 1})
+	if release, err := nilLimiter.Acquire(context.Background()); err != nil || release == nil {
+		t.Errorf("nil limiter failed: %v", err)
+	}
+}
+
+func TestServerLimiter(t *testing.T) {
+	defer SetDefaultServerLimit(Limit{})
+
+	l := ServerLimiter("Limit.example.com")
+	for _, host := range []string{"limit.example.com", "limit.example.com:2087", "limit.example.com."} {
+		if ServerLimiter(host) != l {
+			t.Errorf("%s does not share the limiter of its server", host)
+		}
+	}
+	if ServerLimiter("other.example.com") == l {
+		t.Error("servers share a limiter")
+	}
+	if ServerLimiter("[::1]:2083") != ServerLimiter("::1") {
+		t.Error("IPv6 hosts not normalised")
+	}
+
+	SetServerLimit("limit.example.com:2083", Limit{MaxInFlight: 4})
+	if l.Limit().MaxInFlight != 4 {
+		t.Errorf("limit not applied to the existing limiter: %+v", l.Limit())
+	}
+
+	SetDefaultServerLimit(Limit{RequestsPerSecond: 10})
+	if l.Limit().MaxInFlight != 4 || l.Limit().RequestsPerSecond != 0 {
+		t.Errorf("default overrode the limit of the server: %+v", l.Limit())
+	}
+	if got := ServerLimiter("other.example.com").Limit(); got.RequestsPerSecond != 10 {
+		t.Errorf("default not applied: %+v", got)
+	}
+	if got := ServerLimiter("new.example.com").Limit(); got.RequestsPerSecond != 10 {
+		t.Errorf("default not applied to a new server: %+v", got)
+	}
+
+	SetServerLimit("limit.example.com", Limit{})
+	SetDefaultServerLimit(Limit{RequestsPerSecond: 20})
+	if l.Limit().RequestsPerSecond != 0 {
+		t.Errorf("default overrode the zero limit of the server: %+v", l.Limit())
+	}
+	ResetServerLimit("limit.example.com")
+	if l.Limit().RequestsPerSecond != 20 {
+		t.Errorf("server does not follow the default after a reset: %+v", l.Limit())
+	}
+	SetDefaultServerLimit(Limit{RequestsPerSecond: 30})
+	if l.Limit().RequestsPerSecond != 30 {
+		t.Errorf("server does not follow the default after a reset: %+v", l.Limit())
+	}
+}
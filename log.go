@@ -0,0 +1,345 @@
+package cpanelgo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type LogLevel int
+
+const (
+	LogDebug LogLevel = iota
+	LogInfo
+	LogWarn
+	LogError
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogDebug:
+		return "DEBUG"
+	case LogInfo:
+		return "INFO"
+	case LogWarn:
+		return "WARN"
+	case LogError:
+		return "ERROR"
+	default:
+		return fmt.Sprintf("LEVEL(%d)", int(l))
+	}
+}
+
+// Fields are the structured values attached to a log entry
+type Fields map[string]interface{}
+
+// Logger receives the log entries of a client. Arguments and response bodies passed
+// in fields have already been redacted.
+type Logger interface {
+	// Enabled reports whether entries at level would be logged at all, so that
+	// expensive fields are only built when needed
+	Enabled(level LogLevel) bool
+	Log(level LogLevel, msg string, fields Fields)
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Enabled(LogLevel) bool        { return false }
+func (nopLogger) Log(LogLevel, string, Fields) {}
+
+// NopLogger discards everything
+var NopLogger Logger = nopLogger{}
+
+type stdLogger struct {
+	l   *log.Logger
+	min LogLevel
+}
+
+// NewStdLogger returns a Logger writing entries at or above min to l, or to the
+// standard logger if l is nil.
+func NewStdLogger(l *log.Logger, min LogLevel) Logger {
+	return stdLogger{l: l, min: min}
+}
+
+func (s stdLogger) Enabled(level LogLevel) bool {
+	return level >= s.min
+}
+
+func (s stdLogger) Log(level LogLevel, msg string, fields Fields) {
+	if !s.Enabled(level) {
+		return
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s] %s", level, msg)
+	for _, k := range keys {
+		fmt.Fprintf(&b, " %s=%q", k, fmt.Sprintf("%v", fields[k]))
+	}
+	if s.l == nil {
+		log.Println(b.String())
+	} else {
+		s.l.Println(b.String())
+	}
+}
+
+// DefaultLogger is used by clients which have no Logger of their own. It logs
+// everything to the standard logger if DEBUG_CPANEL_RESPONSES=1 and nothing otherwise.
+func DefaultLogger() Logger {
+	if os.Getenv("DEBUG_CPANEL_RESPONSES") == "1" {
+		return NewStdLogger(nil, LogDebug)
+	}
+	return NopLogger
+}
+
+const Redacted = "[REDACTED]"
+
+// SensitiveKeys are the (lower case) argument and response field names whose values
+// are never logged or recorded.
+var SensitiveKeys = map[string]bool{
+	"access_hash":       true,
+	"accesshash":        true,
+	"api_token":         true,
+	"cp_security_token": true,
+	"key":               true,
+	"newpass":           true,
+	"pass":              true,
+	"passwd":            true,
+	"password":          true,
+	"private_key":       true,
+	"secret":            true,
+	"security_token":    true,
+	"session":           true,
+	"tfa_token":         true,
+	"token":             true,
+}
+
+func isSensitive(key string) bool {
+	return SensitiveKeys[strings.ToLower(key)]
+}
+
+// private keys and session tokens, such as the URLs returned by create_user_session,
+// are redacted wherever they appear
+func isSensitiveValue(v string) bool {
+	return strings.Contains(v, "PRIVATE KEY-----") ||
+		securityTokenRegexp.MatchString(v) ||
+		strings.Contains(v, "session=")
+}
+
+// RedactArgs returns a copy of args with the values of sensitive arguments replaced,
+// along with the private keys and session tokens found in any value, including in the
+// elements of slices, Numbered and the values sent as JSON.
+func RedactArgs(args Args) Args {
+	out := Args{}
+	for k, v := range args {
+		if isSensitive(k) {
+			out[k] = Redacted
+		} else {
+			out[k], _ = redactArg(v)
+		}
+	}
+	return out
+}
+
+// redactArg returns v with the private keys and session tokens it holds replaced, and
+// whether there were any. v is returned as is when there were none.
+func redactArg(v interface{}) (interface{}, bool) {
+	switch vv := v.(type) {
+	case string:
+		if isSensitiveValue(vv) {
+			return Redacted, true
+		}
+		return v, false
+	case Numbered:
+		if r, ok := redactStrings(vv); ok {
+			return Numbered(r), true
+		}
+		return v, false
+	case []string:
+		return redactStrings(vv)
+	case JSONArg:
+		if r, ok := redactJSONArg(vv.Value); ok {
+			return JSONArg{Value: r}, true
+		}
+		return v, false
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if !rv.IsNil() {
+			if r, ok := redactArg(rv.Elem().Interface()); ok {
+				return r, true
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			if rv.Kind() == reflect.Slice && isSensitiveValue(string(rv.Bytes())) {
+				return Redacted, true
+			}
+			break
+		}
+		out := make([]interface{}, rv.Len())
+		changed := false
+		for i := range out {
+			var ok bool
+			out[i], ok = redactArg(rv.Index(i).Interface())
+			changed = changed || ok
+		}
+		if changed {
+			return out, true
+		}
+	case reflect.Map, reflect.Struct:
+		return redactJSONArg(v)
+	}
+	return v, false
+}
+
+func redactStrings(values []string) ([]string, bool) {
+	var out []string
+	for i, s := range values {
+		if isSensitiveValue(s) {
+			if out == nil {
+				out = append([]string(nil), values...)
+			}
+			out[i] = Redacted
+		}
+	}
+	if out == nil {
+		return values, false
+	}
+	return out, true
+}
+
+// redactJSONArg redacts v as it is sent, as JSON, returning it decoded from JSON if
+// anything was redacted
+func redactJSONArg(v interface{}) (interface{}, bool) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return v, false
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(buf, &decoded); err != nil {
+		return v, false
+	}
+	before, _ := json.Marshal(decoded)
+	redacted := redactValue(decoded)
+	if after, _ := json.Marshal(redacted); bytes.Equal(before, after) {
+		return v, false
+	}
+	return redacted, true
+}
+
+// RedactPositionalArgs returns a copy of API1 arguments with private keys and the
+// values of sensitive "key=value" arguments replaced.
+func RedactPositionalArgs(args []string) []string {
+	out := make([]string, len(args))
+	for i, v := range args {
+		kv := strings.SplitN(v, "=", 2)
+		switch {
+		case isSensitiveValue(v):
+			out[i] = Redacted
+		case len(kv) == 2 && isSensitive(kv[0]):
+			out[i] = kv[0] + "=" + Redacted
+		default:
+			out[i] = v
+		}
+	}
+	return out
+}
+
+// RedactJSON returns body with the values of sensitive fields, private keys and session
+// tokens replaced, at any depth. Bodies which are not JSON are returned unchanged, use
+// RedactBody to log them.
+func RedactJSON(body []byte) []byte {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return body
+	}
+	out, err := json.Marshal(redactValue(v))
+	if err != nil {
+		return body
+	}
+	return out
+}
+
+// RedactBody returns body as RedactJSON does, to be logged. A body which is not JSON,
+// such as one cut short, cannot be redacted and is replaced by its length.
+func RedactBody(body []byte) string {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return fmt.Sprintf("[%d bytes, not JSON]", len(body))
+	}
+	out, err := json.Marshal(redactValue(v))
+	if err != nil {
+		return fmt.Sprintf("[%d bytes]", len(body))
+	}
+	return string(out)
+}
+
+// RedactURL returns u without the query string, which carries the arguments, and
+// without the session security token.
+func RedactURL(u *url.URL) string {
+	redacted := *u
+	redacted.RawQuery = ""
+	redacted.Path = securityTokenRegexp.ReplaceAllString(u.Path, "/cpsess"+Redacted)
+	// keep the marker readable rather than percent-encoded
+	redacted.RawPath = securityTokenRegexp.ReplaceAllString(u.EscapedPath(), "/cpsess"+Redacted)
+	return redacted.String()
+}
+
+var securityTokenRegexp = regexp.MustCompile(`/cpsess[0-9]+`)
+
+func redactValue(v interface{}) interface{} {
+	switch vv := v.(type) {
+	case map[string]interface{}:
+		for k, e := range vv {
+			if isSensitive(k) {
+				// keep empty values visible, they are often what is being debugged
+				if s, ok := e.(string); ok && s == "" {
+					continue
+				}
+				vv[k] = Redacted
+			} else {
+				vv[k] = redactValue(e)
+			}
+		}
+	case []interface{}:
+		for i, e := range vv {
+			vv[i] = redactValue(e)
+		}
+	case string:
+		if isSensitiveValue(vv) {
+			return Redacted
+		}
+	}
+	return v
+}
+
+// LogFields describes the call for a log entry, with its arguments redacted.
+func (c *Call) LogFields() Fields {
+	f := Fields{
+		"api_version": c.APIVersion,
+		"function":    c.Function,
+	}
+	if c.Module != "" {
+		f["module"] = c.Module
+	}
+	if c.APIVersion == "1" {
+		f["args"] = RedactPositionalArgs(c.PositionalArgs)
+	} else {
+		f["args"] = RedactArgs(c.Args)
+	}
+	return f
+}
@@ -0,0 +1,38 @@
+package cpanelgo
+
+// MethodPolicy decides whether a call is sent as a GET request with its arguments in
+// the query string, or as a POST request with a URL-encoded body. POST keeps large
+// payloads such as certificate chains under URL length limits and out of access logs.
+type MethodPolicy struct {
+	// Calls whose encoded arguments are longer than this many bytes are POSTed.
+	// Zero or less disables the threshold.
+	MaxQueryLength int
+	// Calls which are always POSTed, as "Module::function" or WHM function name
+	ForcePost []string
+}
+
+var DefaultMethodPolicy = MethodPolicy{
+	MaxQueryLength: 2048,
+	ForcePost: []string{
+		"Fileman::upload_files",
+		"SSL::install_ssl",
+
+		"cpanel",
+		"install_service_ssl_certificate",
+	},
+}
+
+// Method returns the HTTP method to use for a call to module::function with the
+// encoded arguments params. For WHM API 1 calls, module is empty.
+func (p MethodPolicy) Method(module, function string, params Params) string {
+	key := callKey(module, function)
+	for _, v := range p.ForcePost {
+		if v == key {
+			return "POST"
+		}
+	}
+	if p.MaxQueryLength > 0 && len(params.Encode()) > p.MaxQueryLength {
+		return "POST"
+	}
+	return "GET"
+}
@@ -0,0 +1,245 @@
+package cpanelgo
+
+import (
+	"context"
+	"strconv"
+)
+
+// Sort orders the results of a call by a column.
+type Sort struct {
+	Column  string
+	Reverse bool
+	// How values are compared, e.g. "alphabet" or "numeric" for cPanel and
+	// "lexicographic" or "numeric" for WHM, the API default if empty
+	Method string
+}
+
+// Filter keeps the results of a call whose column matches term.
+type Filter struct {
+	Column string
+	// e.g. "contains", "eq", "begins", "lt" or "gt", the API default if empty
+	Type string
+	Term string
+}
+
+// Query selects, orders and paginates the results of a call, which the API does
+// before returning them. Add it to the arguments of a call with Args.
+type Query struct {
+	// Results per page, zero returns all of them
+	PageSize int
+	// The page to return, starting at 1
+	Page    int
+	Sort    []Sort
+	Filter  []Filter
+	Columns []string
+}
+
+func (q Query) page() int {
+	if q.Page < 1 {
+		return 1
+	}
+	return q.Page
+}
+
+// Args returns a copy of args with the parameters expressing q for a call to
+// apiVersion: "uapi", "2" or "whmapi1". Other versions cannot express a query and
+// get args unchanged.
+func (q Query) Args(apiVersion string, args Args) Args {
+	out := Args{}
+	for k, v := range args {
+		out[k] = v
+	}
+
+	switch apiVersion {
+	case "uapi":
+		q.cpanelArgs(out, "api.", "_")
+	case "2":
+		q.cpanelArgs(out, "api2_", "_")
+	case "whmapi1":
+		q.whmArgs(out)
+	}
+	return out
+}
+
+// cpanelArgs adds the parameters of UAPI (api.paginate_size, ...) or API2
+// (api2_paginate_size, ...), which number repeated sorts and filters with a suffix
+func (q Query) cpanelArgs(args Args, prefix, sep string) {
+	if q.PageSize > 0 {
+		args[prefix+"paginate"] = 1
+		args[prefix+"paginate_size"] = q.PageSize
+		args[prefix+"paginate_start"] = (q.page()-1)*q.PageSize + 1
+	}
+
+	suffix := func(i, n int) string {
+		if n == 1 {
+			return ""
+		}
+		return sep + strconv.Itoa(i)
+	}
+	if len(q.Sort) > 0 {
+		args[prefix+"sort"] = 1
+	}
+	for i, s := range q.Sort {
+		sfx := suffix(i, len(q.Sort))
+		args[prefix+"sort_column"+sfx] = s.Column
+		if s.Reverse {
+			args[prefix+"sort_reverse"+sfx] = 1
+		}
+		if s.Method != "" {
+			args[prefix+"sort_method"+sfx] = s.Method
+		}
+	}
+	if len(q.Filter) > 0 {
+		args[prefix+"filter"] = 1
+	}
+	for i, f := range q.Filter {
+		sfx := suffix(i, len(q.Filter))
+		args[prefix+"filter_column"+sfx] = f.Column
+		args[prefix+"filter_term"+sfx] = f.Term
+		if f.Type != "" {
+			args[prefix+"filter_type"+sfx] = f.Type
+		}
+	}
+	if len(q.Columns) > 0 {
+		args[prefix+"columns"] = 1
+	}
+	for i, c := range q.Columns {
+		args[prefix+"columns_"+strconv.Itoa(i+1)] = c
+	}
+}
+
+// whmArgs adds the parameters of WHM API 1 (api.chunk.size, ...), which name
+// repeated sorts and filters with letters
+func (q Query) whmArgs(args Args) {
+	if q.PageSize > 0 {
+		args["api.chunk.enable"] = 1
+		args["api.chunk.size"] = q.PageSize
+		args["api.chunk.start"] = (q.page()-1)*q.PageSize + 1
+	}
+	if len(q.Sort) > 0 {
+		args["api.sort.enable"] = 1
+	}
+	for i, s := range q.Sort {
+		p := "api.sort." + letters(i) + "."
+		args[p+"field"] = s.Column
+		if s.Reverse {
+			args[p+"reverse"] = 1
+		}
+		if s.Method != "" {
+			args[p+"method"] = s.Method
+		}
+	}
+	if len(q.Filter) > 0 {
+		args["api.filter.enable"] = 1
+	}
+	for i, f := range q.Filter {
+		p := "api.filter." + letters(i) + "."
+		args[p+"field"] = f.Column
+		args[p+"arg0"] = f.Term
+		if f.Type != "" {
+			args[p+"type"] = f.Type
+		}
+	}
+	if len(q.Columns) > 0 {
+		args["api.columns.enable"] = 1
+	}
+	for i, c := range q.Columns {
+		args["api.columns."+letters(i)] = c
+	}
+}
+
+// letters names the i-th item a, b, ..., z, aa, ab, ...
+func letters(i int) string {
+	s := string(rune('a' + i%26))
+	for i /= 26; i > 0; i = (i - 1) / 26 {
+		s = string(rune('a'+(i-1)%26)) + s
+	}
+	return s
+}
+
+// Pagination describes which page of the results a response holds.
+type Pagination struct {
+	TotalResults   int `json:"total_results"`
+	TotalPages     int `json:"total_pages"`
+	CurrentPage    int `json:"current_page"`
+	ResultsPerPage int `json:"results_per_page"`
+	StartResult    int `json:"start_result"`
+}
+
+// Paginated is implemented by responses which may hold one page of the results,
+// reporting false if the response was not paginated.
+type Paginated interface {
+	Pagination() (Pagination, bool)
+}
+
+// PageFunc fetches the page of results selected by q.
+type PageFunc func(ctx context.Context, q Query) (Paginated, error)
+
+// PageIterator walks the pages of a paginated call:
+//
+//	it := cpanelgo.NewPageIterator(cpanelgo.Query{PageSize: 1000}, func(ctx context.Context, q cpanelgo.Query) (cpanelgo.Paginated, error) {
+//		return api.ListAccountsQueryContext(ctx, q)
+//	})
+//	for it.Next(ctx) {
+//		accounts := it.Response().(whm.ListAccountsApiResponse)
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+//
+// It stops after the last page, or after the first response if the call was not
+// paginated.
+type PageIterator struct {
+	query Query
+	fetch PageFunc
+	resp  Paginated
+	err   error
+	done  bool
+}
+
+// NewPageIterator returns an iterator fetching the pages of q with fetch, starting
+// at q.Page.
+func NewPageIterator(q Query, fetch PageFunc) *PageIterator {
+	return &PageIterator{query: q, fetch: fetch}
+}
+
+// Next fetches the next page, reporting whether there was one.
+func (it *PageIterator) Next(ctx context.Context) bool {
+	if it.done || it.err != nil {
+		return false
+	}
+
+	q := it.query
+	q.Page = q.page()
+	resp, err := it.fetch(ctx, q)
+	if err != nil {
+		it.err = err
+		it.resp = nil
+		return false
+	}
+	it.resp = resp
+
+	p, ok := resp.Pagination()
+	if !ok || q.PageSize <= 0 || p.CurrentPage < q.Page || p.CurrentPage >= p.TotalPages {
+		it.done = true
+	} else {
+		it.query.Page = p.CurrentPage + 1
+	}
+	return true
+}
+
+// Response returns the page fetched by the last call to Next.
+func (it *PageIterator) Response() Paginated {
+	return it.resp
+}
+
+// Query returns the query of the next page to fetch.
+func (it *PageIterator) Query() Query {
+	return it.query
+}
+
+// Err returns the error which stopped the iteration, if any.
+func (it *PageIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,110 @@
+package cpanelgo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestQueryArgs(t *testing.T) {
+	q := Query{
+		PageSize: 50,
+		Page:     3,
+		Sort:     []Sort{{Column: "domain", Reverse: true}},
+		Filter:   []Filter{{Column: "type", Type: "eq", Term: "A"}, {Column: "name", Term: "www"}},
+		Columns:  []string{"name", "type"},
+	}
+	args := Args{"domain": "example.com"}
+
+	uapi := q.Args("uapi", args)
+	expected := Args{
+		"domain":              "example.com",
+		"api.paginate":        1,
+		"api.paginate_size":   50,
+		"api.paginate_start":  101,
+		"api.sort":            1,
+		"api.sort_column":     "domain",
+		"api.sort_reverse":    1,
+		"api.filter":          1,
+		"api.filter_column_0": "type",
+		"api.filter_type_0":   "eq",
+		"api.filter_term_0":   "A",
+		"api.filter_column_1": "name",
+		"api.filter_term_1":   "www",
+		"api.columns":         1,
+		"api.columns_1":       "name",
+		"api.columns_2":       "type",
+	}
+	if !reflect.DeepEqual(uapi, expected) {
+		t.Errorf("unexpected UAPI arguments: %v", uapi)
+	}
+	if len(args) != 1 {
+		t.Errorf("arguments were modified: %v", args)
+	}
+
+	if api2 := q.Args("2", nil); api2["api2_paginate_start"] != 101 || api2["api2_filter_term_1"] != "www" {
+		t.Errorf("unexpected API2 arguments: %v", api2)
+	}
+
+	whm := q.Args("whmapi1", nil)
+	if whm["api.chunk.enable"] != 1 || whm["api.chunk.start"] != 101 || whm["api.sort.a.field"] != "domain" ||
+		whm["api.filter.b.arg0"] != "www" || whm["api.columns.b"] != "type" {
+		t.Errorf("unexpected WHM arguments: %v", whm)
+	}
+
+	for i, expected := range map[int]string{0: "a", 25: "z", 26: "aa", 27: "ab", 701: "zz", 702: "aaa"} {
+		if l := letters(i); l != expected {
+			t.Errorf("letters(%d): expected %s, got: %s", i, expected, l)
+		}
+	}
+}
+
+func TestPageIterator(t *testing.T) {
+	var out BaseUAPIResponse
+	if err := json.Unmarshal([]byte(`{"status":1,"metadata":{"transformed":1,"paginate":{"total_results":5,"total_pages":3,"current_page":1,"results_per_page":2,"start_result":1}}}`), &out); err != nil {
+		t.Fatal(err)
+	}
+	if p, ok := out.Pagination(); !ok || p.TotalPages != 3 || p.TotalResults != 5 {
+		t.Errorf("unexpected pagination: %+v, %v", p, ok)
+	}
+
+	var pages []int
+	it := NewPageIterator(Query{PageSize: 2}, func(ctx context.Context, q Query) (Paginated, error) {
+		pages = append(pages, q.Page)
+		var r BaseUAPIResponse
+		r.Metadata.Paginate = &Pagination{TotalPages: 3, CurrentPage: q.Page, ResultsPerPage: q.PageSize}
+		return r, nil
+	})
+	n := 0
+	for it.Next(context.Background()) {
+		if p, _ := it.Response().Pagination(); p.CurrentPage != n+1 {
+			t.Errorf("unexpected page: %+v", p)
+		}
+		n++
+	}
+	if it.Err() != nil || !reflect.DeepEqual(pages, []int{1, 2, 3}) {
+		t.Errorf("unexpected pages: %v, %v", pages, it.Err())
+	}
+
+	// a call which ignores pagination is fetched once
+	calls := 0
+	it = NewPageIterator(Query{PageSize: 2}, func(ctx context.Context, q Query) (Paginated, error) {
+		calls++
+		return BaseUAPIResponse{}, nil
+	})
+	for it.Next(context.Background()) {
+	}
+	if calls != 1 {
+		t.Errorf("expected one call, got: %d", calls)
+	}
+
+	failure := errors.New("failure")
+	it = NewPageIterator(Query{PageSize: 2}, func(ctx context.Context, q Query) (Paginated, error) {
+		return nil, failure
+	})
+	if it.Next(context.Background()) || it.Err() != failure {
+		t.Errorf("expected the iteration to stop with %v, got: %v", failure, it.Err())
+	}
+}
@@ -0,0 +1,164 @@
+package cpanelgo
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Requester sends the HTTP requests of the cPanel and WHM gateways. It waits for the
+// limiter, authenticates the request with the session or Authenticate, logs into the
+// session again once it expired, then logs and decodes the response.
+type Requester struct {
+	Client *http.Client
+	// Base URL of the server, see Endpoint.URL
+	Base string
+	// Limits the requests, a nil Limiter does not limit anything
+	Limiter *Limiter
+	// When set, requests carry the session instead of being passed to Authenticate
+	Session *Session
+	// Adds the credentials of the gateway to a request sent without a session
+	Authenticate func(req *http.Request) error
+	// Set when Authenticate uses an API token, so that authentication failures are
+	// reported as ErrTokenExpired or ErrTokenRejected
+	TokenAuth bool
+	// Names the API in log messages, such as "cPanel API"
+	Name   string
+	Logger Logger
+	// Maximum size of a response in bytes, see SizeLimit
+	ResponseSizeLimit int64
+}
+
+// Do sends a request for path, relative to Base, with params in the query string or
+// the body depending on method. A session which was refused or redirected to the login
+// page has expired, it is logged into again and the request sent once more. The
+// request counts against the limiter until the body of the response is closed.
+func (r Requester) Do(ctx context.Context, method, path string, params Params) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		release, err := r.Limiter.Acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		reqUrl := r.Base + "/" + path
+		var token string
+		if r.Session != nil {
+			// https://hostname.example.com:2083/login/?login_only=1
+			if token, err = r.Session.Token(ctx, r.Client, r.Base+"/login/?login_only=1"); err != nil {
+				release()
+				return nil, err
+			}
+			reqUrl = r.Base + token + "/" + path
+		}
+
+		var req *http.Request
+		if method == "POST" {
+			req, err = http.NewRequestWithContext(ctx, "POST", reqUrl, strings.NewReader(params.Encode()))
+			if err == nil {
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+		} else {
+			req, err = http.NewRequestWithContext(ctx, "GET", reqUrl+"?"+params.Encode(), nil)
+		}
+		if err == nil {
+			if r.Session != nil {
+				r.Session.AddCookies(req)
+			} else if r.Authenticate != nil {
+				err = r.Authenticate(req)
+			}
+		}
+		if err != nil {
+			release()
+			return nil, err
+		}
+
+		resp, err := r.Client.Do(req)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		ReleaseOnClose(resp, release)
+		if resp.Request == nil {
+			resp.Request = req
+		}
+
+		if r.Session != nil && (resp.StatusCode == http.StatusUnauthorized ||
+			resp.StatusCode == http.StatusForbidden || loginPage(resp)) {
+			if attempt == 1 {
+				resp.Body.Close()
+				r.Session.Invalidate(token)
+				continue
+			}
+			if loginPage(resp) {
+				resp.Body.Close()
+				return nil, &APIError{
+					StatusCode: resp.StatusCode,
+					Errors:     []string{"redirected to the login page"},
+					Err:        ErrLoginFailed,
+				}
+			}
+		}
+		return resp, nil
+	}
+}
+
+// loginPage reports whether resp is the login page, which cpsrvd redirects the requests
+// of an expired session to instead of answering them with JSON
+func loginPage(resp *http.Response) bool {
+	if strings.HasPrefix(resp.Request.URL.Path, "/login") {
+		return true
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return mediaType == "text/html"
+}
+
+// Call sends the request for call with Do and decodes the JSON response into out. It
+// returns info completed with the response, for the gateway to record on out, or an
+// *APIError describing a failed HTTP request.
+func (r Requester) Call(ctx context.Context, call *Call, info ResponseInfo, method, path string, params Params, out interface{}) (ResponseInfo, error) {
+	resp, err := r.Do(ctx, method, path, params)
+	if err != nil {
+		return info, err
+	}
+	defer resp.Body.Close()
+	info.StatusCode = resp.StatusCode
+
+	l := r.Logger
+	if l == nil {
+		l = DefaultLogger()
+	}
+
+	if resp.StatusCode >= 300 {
+		info.Body, _ = ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		apiErr := info.NewAPIError(nil, nil, nil)
+		if r.TokenAuth {
+			apiErr.Err = TokenAuthError(resp.StatusCode, info.Body)
+		}
+		if l.Enabled(LogWarn) {
+			l.Log(LogWarn, r.Name+" request failed", r.logFields(call, resp, info.Body))
+		}
+		return info, apiErr
+	}
+
+	body := NewResponseReader(resp.Body, r.ResponseSizeLimit, l.Enabled(LogDebug))
+	err = body.Decode(out)
+	call.ResponseSize = body.Len()
+
+	if l.Enabled(LogDebug) {
+		l.Log(LogDebug, r.Name+" response", r.logFields(call, resp, body.Bytes()))
+	}
+
+	info.Body = body.Bytes()
+	return info, err
+}
+
+func (r Requester) logFields(call *Call, resp *http.Response, body []byte) Fields {
+	fields := call.LogFields()
+	fields["url"] = RedactURL(resp.Request.URL)
+	fields["status"] = resp.Status
+	fields["body"] = RedactBody(body)
+	return fields
+}
@@ -0,0 +1,132 @@
+package cpanelgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequesterRelogin(t *testing.T) {
+	logins := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/login/") {
+			logins++
+			fmt.Fprintf(w, `{"status":1,"security_token":"/cpsess%010d"}`, logins)
+			return
+		}
+		// the first session has expired
+		if !strings.HasPrefix(r.URL.Path, "/cpsess0000000002/") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"status":1,"data":"` + r.URL.Query().Get("name") + `"}`))
+	}))
+	defer srv.Close()
+
+	r := Requester{
+		Client:  srv.Client(),
+		Base:    srv.URL,
+		Session: NewSession("bob", "hunter2", ""),
+		Authenticate: func(req *http.Request) error {
+			t.Error("authenticated a request sent with a session")
+			return nil
+		},
+		Logger: NopLogger,
+	}
+	var out struct {
+		Data string `json:"data"`
+	}
+	info, err := r.Call(context.Background(), &Call{}, ResponseInfo{Function: "get"}, "GET", "execute/Mod/get", Params{{Name: "name", Value: "x"}}, &out)
+	if err != nil || out.Data != "x" || info.StatusCode != http.StatusOK || info.Function != "get" {
+		t.Errorf("unexpected result: %+v, %+v, %v", out, info, err)
+	}
+	if logins != 2 {
+		t.Errorf("expected to log in again once, logged in %d times", logins)
+	}
+}
+
+func TestRequesterTokenAuth(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "cpanel bob:TOKEN" {
+			t.Errorf("unexpected credentials: %q", r.Header.Get("Authorization"))
+		}
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("The API token has expired."))
+	}))
+	defer srv.Close()
+
+	r := Requester{
+		Client: srv.Client(),
+		Base:   srv.URL,
+		Authenticate: func(req *http.Request) error {
+			req.Header.Set("Authorization", "cpanel bob:TOKEN")
+			return nil
+		},
+		TokenAuth: true,
+		Logger:    NopLogger,
+	}
+	_, err := r.Call(context.Background(), &Call{}, ResponseInfo{}, "GET", "execute/Mod/get", nil, nil)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusForbidden || !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	failed := errors.New("no credentials")
+	r.Authenticate = func(req *http.Request) error { return failed }
+	r.Limiter = NewLimiter(Limit{MaxInFlight: 1})
+	if _, err := r.Do(context.Background(), "GET", "execute/Mod/get", nil); err != failed {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := r.Limiter.Acquire(context.Background()); err != nil {
+		t.Errorf("failed request still holds the limiter: %v", err)
+	}
+}
+
+func TestRequesterLoginRedirect(t *testing.T) {
+	logins := 0
+	alwaysExpired := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/login/" && r.Method == "POST":
+			logins++
+			fmt.Fprintf(w, `{"status":1,"security_token":"/cpsess%010d"}`, logins)
+		case r.URL.Path == "/login/":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte("<html><form>login</form></html>"))
+		case alwaysExpired || r.URL.Path == "/cpsess0000000001/execute/Mod/get":
+			http.Redirect(w, r, "/login/?login_only=0", http.StatusFound)
+		default:
+			w.Write([]byte(`{"status":1,"data":"ok"}`))
+		}
+	}))
+	defer srv.Close()
+
+	r := Requester{
+		Client:  srv.Client(),
+		Base:    srv.URL,
+		Session: NewSession("bob", "hunter2", ""),
+		Logger:  NopLogger,
+	}
+	var out struct {
+		Data string `json:"data"`
+	}
+	if _, err := r.Call(context.Background(), &Call{}, ResponseInfo{}, "GET", "execute/Mod/get", nil, &out); err != nil || out.Data != "ok" {
+		t.Errorf("unexpected result: %+v, %v", out, err)
+	}
+	if logins != 2 {
+		t.Errorf("expected to log in again once, logged in %d times", logins)
+	}
+
+	// a session which keeps being sent to the login page fails instead of being
+	// decoded as JSON
+	r.Session.Invalidate("/cpsess0000000002")
+	alwaysExpired = true
+	_, err := r.Call(context.Background(), &Call{}, ResponseInfo{}, "GET", "execute/Mod/get", nil, &out)
+	if !errors.Is(err, ErrLoginFailed) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
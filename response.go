@@ -0,0 +1,115 @@
+package cpanelgo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// ResponseTooLargeError is returned when a response is larger than the size limit
+// of the client that received it.
+type ResponseTooLargeError struct {
+	// The size limit in bytes
+	Limit int64
+	// Number of bytes read before giving up
+	Read int64
+}
+
+func (e *ResponseTooLargeError) Error() string {
+	return fmt.Sprintf("API response maximum size exceeded: read %d bytes, limit is %d", e.Read, e.Limit)
+}
+
+// SizeLimit returns limit, or the process wide ResponseSizeLimit if limit is zero
+// or less.
+func SizeLimit(limit int64) int64 {
+	if limit <= 0 {
+		return int64(ResponseSizeLimit)
+	}
+	return limit
+}
+
+// ResponseReader reads a response body, failing with a *ResponseTooLargeError once
+// more than its limit has been read. It keeps the start of the body, or all of it if
+// asked to, for logging and error reports.
+type ResponseReader struct {
+	r       io.Reader
+	limit   int64
+	n       int64
+	keepAll bool
+	head    []byte
+}
+
+// NewResponseReader limits r to limit bytes (see SizeLimit). keepAll retains the
+// whole body instead of only its start, e.g. to log it.
+func NewResponseReader(r io.Reader, limit int64, keepAll bool) *ResponseReader {
+	return &ResponseReader{
+		r:       r,
+		limit:   SizeLimit(limit),
+		keepAll: keepAll,
+	}
+}
+
+func (r *ResponseReader) Read(p []byte) (int, error) {
+	if r.n > r.limit {
+		return 0, r.tooLarge()
+	}
+
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+
+	keep := n
+	if !r.keepAll && len(r.head)+keep > bodySnippetLength {
+		keep = bodySnippetLength - len(r.head)
+	}
+	if keep > 0 {
+		r.head = append(r.head, p[:keep]...)
+	}
+
+	if r.n > r.limit {
+		return n, r.tooLarge()
+	}
+	return n, err
+}
+
+func (r *ResponseReader) tooLarge() error {
+	return &ResponseTooLargeError{Limit: r.limit, Read: r.n}
+}
+
+// Len returns the number of bytes read so far.
+func (r *ResponseReader) Len() int64 {
+	return r.n
+}
+
+// Bytes returns the body read so far, or its start unless the whole body is kept.
+func (r *ResponseReader) Bytes() []byte {
+	return r.head
+}
+
+// Decode decodes the JSON value in the body into out without buffering the body,
+// then drains the rest of it so the connection can be reused. As with json.Unmarshal,
+// anything but white space after the value is an error.
+func (r *ResponseReader) Decode(out interface{}) error {
+	dec := json.NewDecoder(r)
+	if err := dec.Decode(out); err != nil {
+		return err
+	}
+
+	rest := io.MultiReader(dec.Buffered(), r)
+	buf := make([]byte, 4096)
+	for {
+		n, err := rest.Read(buf)
+		for _, c := range buf[:n] {
+			if c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+				io.Copy(ioutil.Discard, r)
+				return fmt.Errorf("invalid character %q after top-level value", c)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package cpanelgo
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestResponseReader(t *testing.T) {
+	body := `{"data":"` + strings.Repeat("x", 1000) + `"}` + "\n"
+
+	var out struct{ Data string }
+	r := NewResponseReader(strings.NewReader(body), 2048, false)
+	if err := r.Decode(&out); err != nil || len(out.Data) != 1000 {
+		t.Fatalf("unexpected result: %v", err)
+	}
+	if r.Len() != int64(len(body)) {
+		t.Errorf("expected %d bytes read, got: %d", len(body), r.Len())
+	}
+	if len(r.Bytes()) != bodySnippetLength || !strings.HasPrefix(body, string(r.Bytes())) {
+		t.Errorf("unexpected start of body: %q", r.Bytes())
+	}
+
+	r = NewResponseReader(strings.NewReader(body), 100, true)
+	err := r.Decode(&out)
+	var tooLarge *ResponseTooLargeError
+	if !errors.As(err, &tooLarge) || tooLarge.Limit != 100 || tooLarge.Read <= 100 {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if int64(len(r.Bytes())) != tooLarge.Read {
+		t.Errorf("expected the whole body read to be kept, got %d bytes", len(r.Bytes()))
+	}
+}
+
+func TestResponseReaderTrailingData(t *testing.T) {
+	var out struct{ Status int }
+	for body, valid := range map[string]bool{
+		`{"status":1}`:             true,
+		"{\"status\":1} \r\n\t":    true,
+		`{"status":1}{"status":0}`: false,
+		`{"status":1} <html>`:      false,
+	} {
+		r := NewResponseReader(strings.NewReader(body), 0, false)
+		if err := r.Decode(&out); (err == nil) != valid {
+			t.Errorf("%q: unexpected error: %v", body, err)
+		}
+		if r.Len() != int64(len(body)) {
+			t.Errorf("%q: body not drained, read %d bytes", body, r.Len())
+		}
+	}
+}
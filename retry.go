@@ -0,0 +1,221 @@
+package cpanelgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"reflect"
+	"syscall"
+	"time"
+)
+
+// Calls which only read state and so are safe to repeat, keyed by "Module::function"
+// for cPanel calls and by function name for WHM API 1 calls.
+var idempotentCalls = map[string]bool{
+	"Chrome::get_dom":                true,
+	"DomainInfo::domains_data":       true,
+	"DomainInfo::single_domain_data": true,
+	"Features::has_feature":          true,
+	"Locale::get_attributes":         true,
+	"Locale::get_user_locale":        true,
+	"NVData::get":                    true,
+	"Park::listparkeddomains":        true,
+	"Quota::get_quota_info":          true,
+	"SSL::installed_hosts":           true,
+	"SSL::is_mail_sni_supported":     true,
+	"SSL::list_certs":                true,
+	"SSL::list_keys":                 true,
+	"SSL::mail_sni_status":           true,
+	"Themes::get_theme_base":         true,
+	"WebVhosts::list_domains":        true,
+	"ZoneEdit::fetchzone":            true,
+	"ZoneEdit::fetchzones":           true,
+
+	"accountsummary":               true,
+	"fetch_service_ssl_components": true,
+	"fetch_ssl_vhosts":             true,
+	"get_tweaksetting":             true,
+	"listaccts":                    true,
+	"resolvedomainname":            true,
+	"version":                      true,
+}
+
+func callKey(module, function string) string {
+	if module == "" {
+		return function
+	}
+	return module + "::" + function
+}
+
+// RetryPolicy describes how calls which failed for a transient reason are retried.
+// Only calls that are safe to repeat are retried.
+type RetryPolicy struct {
+	// Total number of attempts, including the first one
+	MaxAttempts int
+	// Delay before the first retry, doubled for each following one
+	BaseDelay time.Duration
+	// Upper bound of the delay between two attempts
+	MaxDelay time.Duration
+	// Further calls which may be retried, as "Module::function" or WHM function name
+	AlsoRetry []string
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    10 * time.Second,
+}
+
+// Retryable reports whether a call to module::function may be repeated.
+// For WHM API 1 calls, module is empty.
+func (p RetryPolicy) Retryable(module, function string) bool {
+	key := callKey(module, function)
+	if idempotentCalls[key] {
+		return true
+	}
+	for _, v := range p.AlsoRetry {
+		if v == key {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the delay to wait after the given (1-based) failed attempt,
+// exponentially increasing with up to half of it as random jitter
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// Do calls fn until it succeeds, fails permanently, the attempts are exhausted or ctx
+// is done. fn is only called once if module::function is not retryable. If ctx is done
+// while waiting to retry, the error wraps both ctx.Err() and the last failure.
+func (p RetryPolicy) Do(ctx context.Context, module, function string, fn func(ctx context.Context) error) error {
+	attempts := p.MaxAttempts
+	if attempts < 1 || !p.Retryable(module, function) {
+		attempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || attempt >= attempts || !IsTransient(err) {
+			return err
+		}
+
+		t := time.NewTimer(p.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return fmt.Errorf("%w while retrying %s after %d attempts: %w", ctx.Err(), callKey(module, function), attempt, err)
+		case <-t.C:
+		}
+	}
+}
+
+// DoInto is Do for a call decoding its response into out, a pointer. When the call
+// may be retried, each attempt decodes into a fresh value which is copied into out
+// once an attempt succeeds, so that out never mixes the responses of several attempts
+// and is left untouched by a failure.
+func (p RetryPolicy) DoInto(ctx context.Context, module, function string, out interface{}, fn func(ctx context.Context, out interface{}) error) error {
+	rv := reflect.ValueOf(out)
+	if p.MaxAttempts < 2 || !p.Retryable(module, function) || rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return p.Do(ctx, module, function, func(ctx context.Context) error {
+			return fn(ctx, out)
+		})
+	}
+
+	var fresh reflect.Value
+	err := p.Do(ctx, module, function, func(ctx context.Context) error {
+		fresh = reflect.New(rv.Type().Elem())
+		return fn(ctx, fresh.Interface())
+	})
+	if err == nil {
+		rv.Elem().Set(fresh.Elem())
+	}
+	return err
+}
+
+// IsTransient reports whether err is likely to go away if the call is repeated:
+// dropped or reset connections, timeouts and server side (5xx) failures.
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= 500
+	}
+
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// RetryingGateway wraps another gateway and retries calls according to Policy.
+//
+// WHM API 1 has no gateway to wrap, since the typed methods of whm.WhmApi call the
+// concrete client, so WhmApi takes the policy itself through its Retry field.
+type RetryingGateway struct {
+	Gateway ApiGateway
+	Policy  RetryPolicy
+}
+
+func NewRetryingGateway(gw ApiGateway, policy RetryPolicy) *RetryingGateway {
+	return &RetryingGateway{
+		Gateway: gw,
+		Policy:  policy,
+	}
+}
+
+func (g *RetryingGateway) UAPI(module, function string, arguments Args, out interface{}) error {
+	return g.UAPIContext(context.Background(), module, function, arguments, out)
+}
+
+func (g *RetryingGateway) UAPIContext(ctx context.Context, module, function string, arguments Args, out interface{}) error {
+	return g.Policy.DoInto(ctx, module, function, out, func(ctx context.Context, out interface{}) error {
+		return AsContextGateway(g.Gateway).UAPIContext(ctx, module, function, arguments, out)
+	})
+}
+
+func (g *RetryingGateway) API2(module, function string, arguments Args, out interface{}) error {
+	return g.API2Context(context.Background(), module, function, arguments, out)
+}
+
+func (g *RetryingGateway) API2Context(ctx context.Context, module, function string, arguments Args, out interface{}) error {
+	return g.Policy.DoInto(ctx, module, function, out, func(ctx context.Context, out interface{}) error {
+		return AsContextGateway(g.Gateway).API2Context(ctx, module, function, arguments, out)
+	})
+}
+
+func (g *RetryingGateway) API1(module, function string, arguments []string, out interface{}) error {
+	return g.API1Context(context.Background(), module, function, arguments, out)
+}
+
+func (g *RetryingGateway) API1Context(ctx context.Context, module, function string, arguments []string, out interface{}) error {
+	return g.Policy.DoInto(ctx, module, function, out, func(ctx context.Context, out interface{}) error {
+		return AsContextGateway(g.Gateway).API1Context(ctx, module, function, arguments, out)
+	})
+}
+
+func (g *RetryingGateway) Close() error {
+	return g.Gateway.Close()
+}
@@ -0,0 +1,134 @@
+package cpanelgo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type failingGateway struct {
+	calls int
+	errs  []error
+}
+
+func (g *failingGateway) next() error {
+	g.calls++
+	if len(g.errs) == 0 {
+		return nil
+	}
+	err := g.errs[0]
+	g.errs = g.errs[1:]
+	return err
+}
+
+func (g *failingGateway) UAPI(module, function string, arguments Args, out interface{}) error {
+	return g.next()
+}
+func (g *failingGateway) API2(module, function string, arguments Args, out interface{}) error {
+	return g.next()
+}
+func (g *failingGateway) API1(module, function string, arguments []string, out interface{}) error {
+	return g.next()
+}
+func (g *failingGateway) UAPIContext(ctx context.Context, module, function string, arguments Args, out interface{}) error {
+	// every attempt leaves its mark on the response, failed ones too
+	if m, ok := out.(*map[string]int); ok {
+		if *m == nil {
+			*m = map[string]int{}
+		}
+		(*m)["attempt"+strconv.Itoa(g.calls+1)] = g.calls + 1
+	}
+	return g.next()
+}
+func (g *failingGateway) API2Context(ctx context.Context, module, function string, arguments Args, out interface{}) error {
+	return g.next()
+}
+func (g *failingGateway) API1Context(ctx context.Context, module, function string, arguments []string, out interface{}) error {
+	return g.next()
+}
+func (g *failingGateway) Close() error {
+	return nil
+}
+
+func TestRetryingGateway(t *testing.T) {
+	unavailable := ResponseInfo{StatusCode: 503}.NewAPIError(nil, nil, nil)
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+
+	tests := []struct {
+		function string
+		errs     []error
+		calls    int
+		fails    bool
+	}{
+		// read call recovers after transient failures
+		{"list_certs", []error{io.EOF, unavailable}, 3, false},
+		// attempts are exhausted
+		{"list_certs", []error{io.EOF, io.EOF, io.EOF, io.EOF}, 3, true},
+		// permanent failures are not retried
+		{"list_certs", []error{errors.New("permission denied")}, 1, true},
+		// writes are never repeated unless asked for
+		{"install_ssl", []error{io.EOF}, 1, true},
+	}
+
+	for _, test := range tests {
+		inner := &failingGateway{errs: test.errs}
+		gw := NewRetryingGateway(inner, policy)
+		var out interface{}
+		err := gw.UAPI("SSL", test.function, nil, &out)
+		if (err != nil) != test.fails {
+			t.Errorf("SSL::%s: unexpected result: %v", test.function, err)
+		}
+		if inner.calls != test.calls {
+			t.Errorf("SSL::%s: expected %d calls, got: %d", test.function, test.calls, inner.calls)
+		}
+	}
+
+	policy.AlsoRetry = []string{"SSL::install_ssl"}
+	inner := &failingGateway{errs: []error{io.EOF}}
+	if err := NewRetryingGateway(inner, policy).UAPI("SSL", "install_ssl", nil, nil); err != nil || inner.calls != 2 {
+		t.Errorf("opted in call not retried: %v after %d calls", err, inner.calls)
+	}
+}
+
+func TestRetryFreshAttempts(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+
+	inner := &failingGateway{errs: []error{io.EOF, io.EOF}}
+	out := map[string]int{"before": 0}
+	if err := NewRetryingGateway(inner, policy).UAPIContext(context.Background(), "SSL", "list_certs", nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || out["attempt3"] != 3 {
+		t.Errorf("expected the response of the last attempt only, got: %v", out)
+	}
+
+	inner = &failingGateway{errs: []error{io.EOF, io.EOF, io.EOF}}
+	out = map[string]int{"before": 0}
+	if err := NewRetryingGateway(inner, policy).UAPIContext(context.Background(), "SSL", "list_certs", nil, &out); err == nil {
+		t.Fatal("expected the attempts to be exhausted")
+	}
+	if len(out) != 1 || out["before"] != 0 {
+		t.Errorf("failed attempts modified the response: %v", out)
+	}
+}
+
+func TestRetryCanceledDuringBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+	inner := &failingGateway{errs: []error{io.EOF}}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	err := NewRetryingGateway(inner, policy).UAPIContext(ctx, "SSL", "list_certs", nil, nil)
+	if !errors.Is(err, context.Canceled) || !errors.Is(err, io.EOF) {
+		t.Errorf("expected both the cancellation and the last failure, got: %v", err)
+	}
+	if IsTransient(err) {
+		t.Error("a canceled retry must not be retried again")
+	}
+}
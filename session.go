@@ -0,0 +1,173 @@
+package cpanelgo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrLoginFailed is wrapped by the APIError returned when a session could not be established
+var ErrLoginFailed = errors.New("login failed")
+
+// Session logs into cPanel or WHM once and lets later calls reuse the session cookie
+// and security token, instead of authenticating every request. It is safe for
+// concurrent use and logs in again whenever the session is invalidated.
+type Session struct {
+	Username string
+	Password string
+	// Base32 secret for accounts with two-factor authentication
+	TotpSecret string
+
+	mu      sync.Mutex
+	token   string
+	cookies []*http.Cookie
+	// the login in progress, shared by the callers waiting for it
+	login *login
+}
+
+type login struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+func NewSession(username, password, totpSecret string) *Session {
+	return &Session{
+		Username:   username,
+		Password:   password,
+		TotpSecret: totpSecret,
+	}
+}
+
+type loginResponse struct {
+	Status        int    `json:"status"`
+	SecurityToken string `json:"security_token"`
+	Message       string `json:"message"`
+}
+
+// Token returns the security token of the current session (e.g. "/cpsess0123456789"),
+// logging in through loginURL first if there is none. Concurrent callers share a
+// single login, and the lock of the session is not held while it is in progress.
+func (s *Session) Token(ctx context.Context, cl *http.Client, loginURL string) (string, error) {
+	for {
+		s.mu.Lock()
+		if s.token != "" {
+			token := s.token
+			s.mu.Unlock()
+			return token, nil
+		}
+		l := s.login
+		if l == nil {
+			l = &login{done: make(chan struct{})}
+			s.login = l
+			s.mu.Unlock()
+			return s.logIn(ctx, cl, loginURL, l)
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-l.done:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+		// the login was abandoned by its own caller, not failed
+		if errors.Is(l.err, context.Canceled) || errors.Is(l.err, context.DeadlineExceeded) {
+			continue
+		}
+		return l.token, l.err
+	}
+}
+
+// logIn performs l and publishes its outcome to the callers waiting for it
+func (s *Session) logIn(ctx context.Context, cl *http.Client, loginURL string, l *login) (string, error) {
+	token, cookies, err := s.post(ctx, cl, loginURL)
+
+	s.mu.Lock()
+	if err == nil {
+		s.token = token
+		s.cookies = cookies
+	}
+	s.login = nil
+	s.mu.Unlock()
+
+	l.token, l.err = token, err
+	close(l.done)
+	return token, err
+}
+
+// post sends the credentials to loginURL and returns the session it opened
+func (s *Session) post(ctx context.Context, cl *http.Client, loginURL string) (string, []*http.Cookie, error) {
+	form := url.Values{}
+	form.Set("user", s.Username)
+	form.Set("pass", s.Password)
+	if s.TotpSecret != "" {
+		otp, err := TOTP(s.TotpSecret, time.Now())
+		if err != nil {
+			return "", nil, err
+		}
+		form.Set("tfa_token", otp)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", loginURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := cl.Do(req)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return "", nil, err
+	}
+
+	info := ResponseInfo{
+		Function:   "login",
+		StatusCode: resp.StatusCode,
+		Body:       body,
+	}
+	var out loginResponse
+	if err := json.Unmarshal(body, &out); err != nil || out.Status != 1 || out.SecurityToken == "" {
+		var errs []string
+		if out.Message != "" {
+			errs = []string{out.Message}
+		}
+		apiErr := info.NewAPIError(errs, nil, nil)
+		apiErr.Err = ErrLoginFailed
+		return "", nil, apiErr
+	}
+	return out.SecurityToken, resp.Cookies(), nil
+}
+
+// AddCookies adds the cookies of the current session to req.
+func (s *Session) AddCookies(req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, c := range s.cookies {
+		req.AddCookie(c)
+	}
+}
+
+// Invalidate forgets the session identified by token, if it is still the current one,
+// so that the next call logs in again.
+func (s *Session) Invalidate(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token == token {
+		s.token = ""
+		s.cookies = nil
+	}
+}
@@ -0,0 +1,96 @@
+package cpanelgo
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSession(t *testing.T) {
+	const secret = "JBSWY3DPEHPK3PXP"
+	logins := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logins++
+		otp, _ := TOTP(secret, time.Now())
+		if r.FormValue("user") != "bob" || r.FormValue("pass") != "hunter2" || r.FormValue("tfa_token") != otp {
+			w.Write([]byte(`{"status":0,"message":"invalid_login"}`))
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "cpsession", Value: "bob:abc"})
+		w.Write([]byte(`{"status":1,"security_token":"/cpsess0123456789"}`))
+	}))
+	defer srv.Close()
+
+	s := NewSession("bob", "hunter2", secret)
+	for i := 0; i < 2; i++ {
+		token, err := s.Token(context.Background(), srv.Client(), srv.URL+"/login/?login_only=1")
+		if err != nil || token != "/cpsess0123456789" {
+			t.Fatalf("unexpected login result: %q, %v", token, err)
+		}
+	}
+	if logins != 1 {
+		t.Errorf("expected to log in once, logged in %d times", logins)
+	}
+
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	s.AddCookies(req)
+	if c, err := req.Cookie("cpsession"); err != nil || c.Value != "bob:abc" {
+		t.Errorf("session cookie not added: %v", err)
+	}
+
+	s.Invalidate("/cpsess0123456789")
+	s.Password = "wrong"
+	_, err := s.Token(context.Background(), srv.Client(), srv.URL+"/login/?login_only=1")
+	var apiErr *APIError
+	if !errors.Is(err, ErrLoginFailed) || !errors.As(err, &apiErr) || apiErr.Error() != "invalid_login: login failed" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestSessionConcurrentLogin(t *testing.T) {
+	var logins int32
+	unblock := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&logins, 1)
+		<-unblock
+		w.Write([]byte(`{"status":1,"security_token":"/cpsess0123456789"}`))
+	}))
+	defer srv.Close()
+
+	s := NewSession("bob", "hunter2", "")
+	tokens := make(chan string, 4)
+	for i := 0; i < cap(tokens); i++ {
+		go func() {
+			token, _ := s.Token(context.Background(), srv.Client(), srv.URL+"/login/?login_only=1")
+			tokens <- token
+		}()
+	}
+
+	// the session stays usable while the login is in progress
+	added := make(chan struct{})
+	go func() {
+		req, _ := http.NewRequest("GET", srv.URL, nil)
+		s.AddCookies(req)
+		s.Invalidate("/cpsess-other")
+		close(added)
+	}()
+	select {
+	case <-added:
+	case <-time.After(time.Second):
+		t.Fatal("session locked during the login")
+	}
+
+	close(unblock)
+	for i := 0; i < cap(tokens); i++ {
+		if token := <-tokens; token != "/cpsess0123456789" {
+			t.Errorf("unexpected token: %q", token)
+		}
+	}
+	if n := atomic.LoadInt32(&logins); n != 1 {
+		t.Errorf("expected a single login, logged in %d times", n)
+	}
+}
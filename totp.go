@@ -0,0 +1,45 @@
+package cpanelgo
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"time"
+)
+
+// TOTP returns the six digit one-time password for the base32 encoded secret at t,
+// as used by cPanel and WHM two-factor authentication.
+func TOTP(secret string, t time.Time) (string, error) {
+	decodedSecret, err := base32.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return "", err
+	}
+	return totp(decodedSecret, t.Unix(), sha1.New, 6)
+}
+
+func totp(k []byte, t int64, h func() hash.Hash, l int64) (string, error) {
+	if l > 9 || l < 1 {
+		return "", errors.New("Totp: Length out of range.")
+	}
+
+	time := new(bytes.Buffer)
+
+	err := binary.Write(time, binary.BigEndian, (t-int64(0))/int64(30))
+	if err != nil {
+		return "", err
+	}
+
+	hash := hmac.New(h, k)
+	hash.Write(time.Bytes())
+	v := hash.Sum(nil)
+
+	o := v[len(v)-1] & 0xf
+	c := (int32(v[o]&0x7f)<<24 | int32(v[o+1])<<16 | int32(v[o+2])<<8 | int32(v[o+3])) % 1000000000
+
+	return fmt.Sprintf("%010d", c)[10-l : 10], nil
+}
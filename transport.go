@@ -0,0 +1,84 @@
+package cpanelgo
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// TransportConfig configures the pooled keep-alive transport of clients created
+// with NewHTTPClient.
+type TransportConfig struct {
+	// Skip verification of the server certificate
+	Insecure bool
+	// Idle connections kept per host, defaults to 8
+	MaxIdleConnsPerHost int
+	// Limit of connections per host, zero means no limit
+	MaxConnsPerHost int
+	// How long idle connections are kept, defaults to 90 seconds
+	IdleConnTimeout time.Duration
+	// Time limit for each request including reading the response, zero means no limit
+	Timeout time.Duration
+	// Connect through the proxy given by HTTPS_PROXY and NO_PROXY, which are ignored
+	// by default
+	ProxyFromEnvironment bool
+}
+
+// NewHTTPClient returns a client whose connections are kept alive and reused. It is
+// safe for concurrent use and may be shared by any number of gateways, e.g. when
+// impersonating many cPanel users on the same server.
+func NewHTTPClient(config TransportConfig) *http.Client {
+	if config.MaxIdleConnsPerHost <= 0 {
+		config.MaxIdleConnsPerHost = 8
+	}
+	if config.IdleConnTimeout <= 0 {
+		config.IdleConnTimeout = 90 * time.Second
+	}
+
+	var proxy func(*http.Request) (*url.URL, error)
+	if config.ProxyFromEnvironment {
+		proxy = http.ProxyFromEnvironment
+	}
+
+	return &http.Client{
+		Timeout: config.Timeout,
+		Transport: &http.Transport{
+			Proxy: proxy,
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			MaxIdleConns:        100,
+			MaxIdleConnsPerHost: config.MaxIdleConnsPerHost,
+			MaxConnsPerHost:     config.MaxConnsPerHost,
+			IdleConnTimeout:     config.IdleConnTimeout,
+			TLSHandshakeTimeout: 10 * time.Second,
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: config.Insecure,
+			},
+		},
+	}
+}
+
+var (
+	sharedClientsMu sync.Mutex
+	sharedClients   = map[bool]*http.Client{}
+)
+
+// SharedHTTPClient returns the client used by gateways which were not given their own.
+// There is one client for verified and one for insecure connections, each created
+// on first use with the default TransportConfig.
+func SharedHTTPClient(insecure bool) *http.Client {
+	sharedClientsMu.Lock()
+	defer sharedClientsMu.Unlock()
+
+	cl, ok := sharedClients[insecure]
+	if !ok {
+		cl = NewHTTPClient(TransportConfig{Insecure: insecure})
+		sharedClients[insecure] = cl
+	}
+	return cl
+}
@@ -0,0 +1,42 @@
+package cpanelgo
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestSharedHTTPClient(t *testing.T) {
+	var wg sync.WaitGroup
+	clients := make([]*http.Client, 8)
+	for i := range clients {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			clients[i] = SharedHTTPClient(i%2 == 1)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, cl := range clients {
+		if cl != clients[i%2] {
+			t.Errorf("client %d is not shared", i)
+		}
+	}
+	if clients[0] == clients[1] {
+		t.Error("verified and insecure connections share a client")
+	}
+	if !clients[1].Transport.(*http.Transport).TLSClientConfig.InsecureSkipVerify {
+		t.Error("insecure client verifies certificates")
+	}
+	if clients[0].Transport.(*http.Transport).DisableKeepAlives {
+		t.Error("shared client does not keep connections alive")
+	}
+	if clients[0].Transport.(*http.Transport).Proxy != nil {
+		t.Error("shared client uses the proxy of the environment")
+	}
+	proxied := NewHTTPClient(TransportConfig{ProxyFromEnvironment: true})
+	if proxied.Transport.(*http.Transport).Proxy == nil {
+		t.Error("proxy of the environment not used")
+	}
+}
@@ -1,6 +1,10 @@
 package whm
 
-import "github.com/letsencrypt-cpanel/cpanelgo"
+import (
+	"context"
+
+	"github.com/letsencrypt-cpanel/cpanelgo"
+)
 
 type ListAccountsApiResponse struct {
 	BaseWhmApiResponse
@@ -12,9 +16,30 @@ type ListAccountsApiResponse struct {
 }
 
 func (a WhmApi) ListAccounts() (ListAccountsApiResponse, error) {
+	return a.ListAccountsContext(context.Background())
+}
+
+func (a WhmApi) ListAccountsContext(ctx context.Context) (ListAccountsApiResponse, error) {
+	var out ListAccountsApiResponse
+
+	err := a.WHMAPI1Context(ctx, "listaccts", cpanelgo.Args{}, &out)
+	if err == nil {
+		err = out.Error()
+	}
+
+	return out, err
+}
+
+// ListAccountsQuery lists the accounts selected by q, e.g. one page of them. See
+// cpanelgo.PageIterator to walk all pages.
+func (a WhmApi) ListAccountsQuery(q cpanelgo.Query) (ListAccountsApiResponse, error) {
+	return a.ListAccountsQueryContext(context.Background(), q)
+}
+
+func (a WhmApi) ListAccountsQueryContext(ctx context.Context, q cpanelgo.Query) (ListAccountsApiResponse, error) {
 	var out ListAccountsApiResponse
 
-	err := a.WHMAPI1("listaccts", cpanelgo.Args{}, &out)
+	err := a.WHMAPI1QueryContext(ctx, "listaccts", cpanelgo.Args{}, q, &out)
 	if err == nil {
 		err = out.Error()
 	}
@@ -56,9 +81,13 @@ func (r AccountSummaryApiResponse) Suspended() bool {
 }
 
 func (a WhmApi) AccountSummary(username string) (AccountSummaryApiResponse, error) {
+	return a.AccountSummaryContext(context.Background(), username)
+}
+
+func (a WhmApi) AccountSummaryContext(ctx context.Context, username string) (AccountSummaryApiResponse, error) {
 	var out AccountSummaryApiResponse
 
-	err := a.WHMAPI1("accountsummary", cpanelgo.Args{
+	err := a.WHMAPI1Context(ctx, "accountsummary", cpanelgo.Args{
 		"user": username,
 	}, &out)
 	if err == nil {
@@ -76,9 +105,13 @@ type ResolveDomainNameApiResponse struct {
 }
 
 func (a WhmApi) ResolveDomainName(domain string) (ResolveDomainNameApiResponse, error) {
+	return a.ResolveDomainNameContext(context.Background(), domain)
+}
+
+func (a WhmApi) ResolveDomainNameContext(ctx context.Context, domain string) (ResolveDomainNameApiResponse, error) {
 	var out ResolveDomainNameApiResponse
 
-	err := a.WHMAPI1("resolvedomainname", cpanelgo.Args{
+	err := a.WHMAPI1Context(ctx, "resolvedomainname", cpanelgo.Args{
 		"domain": domain,
 	}, &out)
 	if err == nil {
@@ -0,0 +1,106 @@
+package whm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/letsencrypt-cpanel/cpanelgo"
+)
+
+// Batch queues WHM API 1 calls to send them as one call of the batch function.
+// WHM runs all of them, each succeeding or failing on its own.
+type Batch struct {
+	api   WhmApi
+	calls []*cpanelgo.BatchCall
+}
+
+func (a WhmApi) NewBatch() *Batch {
+	return &Batch{api: a}
+}
+
+// Add queues a call of function, whose response is decoded into out, a pointer to
+// a response type.
+func (b *Batch) Add(function string, args cpanelgo.Args, out interface{}) *cpanelgo.BatchCall {
+	call := cpanelgo.NewBatchCall("", function, args, out)
+	b.calls = append(b.calls, call)
+	return call
+}
+
+// Calls returns the queued calls, in order.
+func (b *Batch) Calls() []*cpanelgo.BatchCall {
+	return append([]*cpanelgo.BatchCall(nil), b.calls...)
+}
+
+// ListAccounts queues WhmApi.ListAccounts.
+func (b *Batch) ListAccounts(out *ListAccountsApiResponse) *cpanelgo.BatchCall {
+	return b.Add("listaccts", cpanelgo.Args{}, out)
+}
+
+// AccountSummary queues WhmApi.AccountSummary.
+func (b *Batch) AccountSummary(username string, out *AccountSummaryApiResponse) *cpanelgo.BatchCall {
+	return b.Add("accountsummary", cpanelgo.Args{"user": username}, out)
+}
+
+type batchApiResponse struct {
+	BaseWhmApiResponse
+	Data struct {
+		Result []json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+func (b *Batch) Do() error {
+	return b.DoContext(context.Background())
+}
+
+// DoContext sends the queued calls and decodes their responses. It fails if the
+// batch could not be sent, and otherwise returns the first error of the calls, whose
+// own errors are reported by their Err.
+func (b *Batch) DoContext(ctx context.Context) error {
+	if len(b.calls) == 0 {
+		return nil
+	}
+
+	commands := make([]string, len(b.calls))
+	for i, call := range b.calls {
+		params, err := cpanelgo.EncodeArgs(call.Args, nil)
+		if err != nil {
+			return err
+		}
+		if call.Function == "" {
+			return errors.New("Batch call without function")
+		}
+		commands[i] = call.Function
+		if len(params) > 0 {
+			commands[i] += "?" + params.Encode()
+		}
+	}
+
+	var out batchApiResponse
+	err := b.api.WHMAPI1Context(ctx, "batch", cpanelgo.Args{"command": commands}, &out)
+	if err == nil {
+		err = out.Error()
+	}
+	if err != nil {
+		return err
+	}
+
+	for i, call := range b.calls {
+		if i >= len(out.Data.Result) {
+			call.Finish(cpanelgo.ErrBatchNotRun)
+			continue
+		}
+		raw := out.Data.Result[i]
+		if err := json.Unmarshal(raw, call.Out()); err != nil {
+			call.Finish(err)
+			continue
+		}
+		SetResponseInfo(call.Out(), cpanelgo.ResponseInfo{
+			APIVersion: "whmapi1",
+			Function:   call.Function,
+			Body:       raw,
+		})
+		call.Finish(cpanelgo.ResponseError(call.Out()))
+	}
+	return cpanelgo.FirstError(b.calls)
+}
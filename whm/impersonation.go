@@ -1,11 +1,11 @@
 package whm
 
 import (
+	"context"
 	"net/http"
+	"strconv"
 	"strings"
 
-	"encoding/json"
-
 	"github.com/letsencrypt-cpanel/cpanelgo"
 	"github.com/letsencrypt-cpanel/cpanelgo/cpanel"
 )
@@ -19,7 +19,7 @@ func NewWhmImpersonationApi(hostname, username, accessHash, userToImpersonate st
 	accessHash = strings.Replace(accessHash, "\n", "", -1)
 	accessHash = strings.Replace(accessHash, "\r", "", -1)
 
-	return cpanel.CpanelApi{cpanelgo.NewApi(
+	return cpanel.CpanelApi{Api: cpanelgo.NewApi(
 		&WhmImpersonationApi{
 			Impersonate: userToImpersonate,
 			WhmApi: WhmApi{
@@ -35,7 +35,7 @@ func NewWhmImpersonationApiWithClient(hostname, username, accessHash, userToImpe
 	accessHash = strings.Replace(accessHash, "\n", "", -1)
 	accessHash = strings.Replace(accessHash, "\r", "", -1)
 
-	return cpanel.CpanelApi{cpanelgo.NewApi(
+	return cpanel.CpanelApi{Api: cpanelgo.NewApi(
 		&WhmImpersonationApi{
 			Impersonate: userToImpersonate,
 			WhmApi: WhmApi{
@@ -52,7 +52,7 @@ func NewWhmImpersonationApiTotp(hostname, username, accessHash, userToImpersonat
 	accessHash = strings.Replace(accessHash, "\n", "", -1)
 	accessHash = strings.Replace(accessHash, "\r", "", -1)
 
-	return cpanel.CpanelApi{cpanelgo.NewApi(
+	return cpanel.CpanelApi{Api: cpanelgo.NewApi(
 		&WhmImpersonationApi{
 			Impersonate: userToImpersonate,
 			WhmApi: WhmApi{
@@ -65,63 +65,141 @@ func NewWhmImpersonationApiTotp(hostname, username, accessHash, userToImpersonat
 		})}
 }
 
+func NewWhmImpersonationApiToken(hostname, username, token, userToImpersonate string, insecure bool) cpanel.CpanelApi {
+	return cpanel.CpanelApi{Api: cpanelgo.NewApi(
+		&WhmImpersonationApi{
+			Impersonate: userToImpersonate,
+			WhmApi:      NewWhmApiToken(hostname, username, token, insecure),
+		})}
+}
+
+func NewWhmImpersonationApiTokenWithClient(hostname, username, token, userToImpersonate string, insecure bool, cl *http.Client) cpanel.CpanelApi {
+	return cpanel.CpanelApi{Api: cpanelgo.NewApi(
+		&WhmImpersonationApi{
+			Impersonate: userToImpersonate,
+			WhmApi:      NewWhmApiTokenWithClient(hostname, username, token, insecure, cl),
+		})}
+}
+
+func NewWhmImpersonationApiTokenTotp(hostname, username, token, userToImpersonate, secret string, insecure bool) cpanel.CpanelApi {
+	return cpanel.CpanelApi{Api: cpanelgo.NewApi(
+		&WhmImpersonationApi{
+			Impersonate: userToImpersonate,
+			WhmApi:      NewWhmApiTokenTotp(hostname, username, token, insecure, secret),
+		})}
+}
+
 func (c *WhmImpersonationApi) UAPI(module, function string, arguments cpanelgo.Args, out interface{}) error {
-	if arguments == nil {
-		arguments = cpanelgo.Args{}
-	}
-	arguments["user"] = c.Impersonate
-	arguments["cpanel_jsonapi_user"] = c.Impersonate
-	arguments["cpanel_jsonapi_apiversion"] = "3"
-	arguments["cpanel_jsonapi_module"] = module
-	arguments["cpanel_jsonapi_func"] = function
-
-	var result cpanelgo.UAPIResult
-	err := c.WHMAPI1("cpanel", arguments, &result)
-	if err == nil {
-		err = result.Error()
-	}
-	if err != nil {
-		return err
-	}
-	return json.Unmarshal(result.Result, out)
+	return c.UAPIContext(context.Background(), module, function, arguments, out)
+}
+
+func (c *WhmImpersonationApi) UAPIContext(ctx context.Context, module, function string, arguments cpanelgo.Args, out interface{}) error {
+	return c.call(ctx, &cpanelgo.Call{
+		APIVersion: "uapi",
+		Module:     module,
+		Function:   function,
+		Args:       arguments,
+	}, out)
 }
 
 func (c *WhmImpersonationApi) API2(module, function string, arguments cpanelgo.Args, out interface{}) error {
-	if arguments == nil {
-		arguments = cpanelgo.Args{}
-	}
-	arguments["user"] = c.Impersonate
-	arguments["cpanel_jsonapi_user"] = c.Impersonate
-	arguments["cpanel_jsonapi_apiversion"] = "2"
-	arguments["cpanel_jsonapi_module"] = module
-	arguments["cpanel_jsonapi_func"] = function
-
-	var result cpanelgo.API2Result
-	err := c.WHMAPI1("cpanel", arguments, &result)
-	if err == nil {
-		err = result.Error()
-	}
-	if err != nil {
-		return err
-	}
-	return json.Unmarshal(result.Result, out)
+	return c.API2Context(context.Background(), module, function, arguments, out)
+}
+
+func (c *WhmImpersonationApi) API2Context(ctx context.Context, module, function string, arguments cpanelgo.Args, out interface{}) error {
+	return c.call(ctx, &cpanelgo.Call{
+		APIVersion: "2",
+		Module:     module,
+		Function:   function,
+		Args:       arguments,
+	}, out)
 }
 
 func (c *WhmImpersonationApi) API1(module, function string, arguments []string, out interface{}) error {
+	return c.API1Context(context.Background(), module, function, arguments, out)
+}
+
+func (c *WhmImpersonationApi) API1Context(ctx context.Context, module, function string, arguments []string, out interface{}) error {
+	return c.call(ctx, &cpanelgo.Call{
+		APIVersion:     "1",
+		Module:         module,
+		Function:       function,
+		PositionalArgs: arguments,
+	}, out)
+}
+
+// call runs a cPanel call through the retry policy and interceptors of the client
+func (c *WhmImpersonationApi) call(ctx context.Context, call *cpanelgo.Call, out interface{}) error {
+	return c.retry(ctx, call.Module, call.Function, out, func(ctx context.Context, out interface{}) error {
+		return c.Interceptors.Invoke(ctx, call, out, c.invoke)
+	})
+}
+
+// invoke performs the cPanel call through the WHM "cpanel" function
+func (c *WhmImpersonationApi) invoke(ctx context.Context, call *cpanelgo.Call, out interface{}) error {
 	args := cpanelgo.Args{}
+	for k, v := range call.Args {
+		args[k] = v
+	}
+	for i, v := range call.PositionalArgs {
+		args["arg-"+strconv.Itoa(i)] = v
+	}
+	apiVersion := call.APIVersion
+	if apiVersion == "uapi" {
+		apiVersion = "3"
+	}
 	args["user"] = c.Impersonate
 	args["cpanel_jsonapi_user"] = c.Impersonate
-	args["cpanel_jsonapi_apiversion"] = "1"
-	args["cpanel_jsonapi_module"] = module
-	args["cpanel_jsonapi_func"] = function
+	args["cpanel_jsonapi_apiversion"] = apiVersion
+	args["cpanel_jsonapi_module"] = call.Module
+	args["cpanel_jsonapi_func"] = call.Function
+
+	whmCall := &cpanelgo.Call{
+		APIVersion: "whmapi1",
+		Function:   "cpanel",
+		Args:       args,
+	}
+	defer func() {
+		call.ResponseSize = whmCall.ResponseSize
+	}()
+
+	info := cpanelgo.ResponseInfo{
+		APIVersion: call.APIVersion,
+		Module:     call.Module,
+		Function:   call.Function,
+		StatusCode: http.StatusOK,
+	}
 
-	if arguments != nil && len(arguments) > 0 {
-		for _, v := range arguments {
-			args[v] = true
+	switch call.APIVersion {
+	case "uapi":
+		var result cpanelgo.UAPIResult
+		err := c.whmapi1(ctx, whmCall, &result)
+		if err == nil {
+			cpanelgo.SetResponseInfo(&result, info)
+			err = result.Error()
+		}
+		if err != nil {
+			return err
 		}
+		return cpanelgo.DecodeResult(result.Result, out, info)
+	case "2":
+		var result cpanelgo.API2Result
+		err := c.whmapi1(ctx, whmCall, &result)
+		if err == nil {
+			cpanelgo.SetResponseInfo(&result, info)
+			err = result.Error()
+		}
+		if err != nil {
+			return err
+		}
+		return cpanelgo.DecodeResult(result.Result, out, info)
+	default:
+		err := c.whmapi1(ctx, whmCall, out)
+		if err == nil {
+			cpanelgo.SetResponseInfo(out, info)
+		}
+		return err
 	}
-
-	return c.WHMAPI1("cpanel", args, out)
 }
 
 func (c *WhmImpersonationApi) Close() error {
@@ -1,11 +1,19 @@
 package whm
 
-import "github.com/letsencrypt-cpanel/cpanelgo"
+import (
+	"context"
+
+	"github.com/letsencrypt-cpanel/cpanelgo"
+)
 
 func (a WhmApi) InstallServiceSslCertificate(service, crt, key, cabundle string) (BaseWhmApiResponse, error) {
+	return a.InstallServiceSslCertificateContext(context.Background(), service, crt, key, cabundle)
+}
+
+func (a WhmApi) InstallServiceSslCertificateContext(ctx context.Context, service, crt, key, cabundle string) (BaseWhmApiResponse, error) {
 	var out BaseWhmApiResponse
 
-	err := a.WHMAPI1("install_service_ssl_certificate", cpanelgo.Args{
+	err := a.WHMAPI1Context(ctx, "install_service_ssl_certificate", cpanelgo.Args{
 		"service":  service,
 		"crt":      crt,
 		"key":      key,
@@ -43,9 +51,13 @@ func (r FetchServiceSslComponentsAPIResponse) Services() []string {
 }
 
 func (a WhmApi) FetchServiceSslComponents() (FetchServiceSslComponentsAPIResponse, error) {
+	return a.FetchServiceSslComponentsContext(context.Background())
+}
+
+func (a WhmApi) FetchServiceSslComponentsContext(ctx context.Context) (FetchServiceSslComponentsAPIResponse, error) {
 	var out FetchServiceSslComponentsAPIResponse
 
-	err := a.WHMAPI1("fetch_service_ssl_components", cpanelgo.Args{}, &out)
+	err := a.WHMAPI1Context(ctx, "fetch_service_ssl_components", cpanelgo.Args{}, &out)
 	if err == nil {
 		err = out.Error()
 	}
@@ -54,9 +66,13 @@ func (a WhmApi) FetchServiceSslComponents() (FetchServiceSslComponentsAPIRespons
 }
 
 func (a WhmApi) RestartService(name string) (BaseWhmApiResponse, error) {
+	return a.RestartServiceContext(context.Background(), name)
+}
+
+func (a WhmApi) RestartServiceContext(ctx context.Context, name string) (BaseWhmApiResponse, error) {
 	var out BaseWhmApiResponse
 
-	err := a.WHMAPI1("restartservice", cpanelgo.Args{
+	err := a.WHMAPI1Context(ctx, "restartservice", cpanelgo.Args{
 		"service": name,
 	}, &out)
 	if err == nil {
@@ -1,6 +1,7 @@
 package whm
 
 import (
+	"context"
 	"github.com/letsencrypt-cpanel/cpanelgo"
 	"github.com/letsencrypt-cpanel/cpanelgo/cpanel"
 )
@@ -19,9 +20,13 @@ type FetchSslVhostsApiResponse struct {
 }
 
 func (a WhmApi) FetchSslVhosts() (FetchSslVhostsApiResponse, error) {
+	return a.FetchSslVhostsContext(context.Background())
+}
+
+func (a WhmApi) FetchSslVhostsContext(ctx context.Context) (FetchSslVhostsApiResponse, error) {
 	var out FetchSslVhostsApiResponse
 
-	err := a.WHMAPI1("fetch_ssl_vhosts", cpanelgo.Args{}, &out)
+	err := a.WHMAPI1Context(ctx, "fetch_ssl_vhosts", cpanelgo.Args{}, &out)
 	if err == nil {
 		err = out.Error()
 	}
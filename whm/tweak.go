@@ -1,6 +1,10 @@
 package whm
 
-import "github.com/letsencrypt-cpanel/cpanelgo"
+import (
+	"context"
+
+	"github.com/letsencrypt-cpanel/cpanelgo"
+)
 
 type GetTweakSettingApiResponse struct {
 	BaseWhmApiResponse
@@ -13,9 +17,13 @@ type GetTweakSettingApiResponse struct {
 }
 
 func (a WhmApi) GetTweakSetting(key, module string) (GetTweakSettingApiResponse, error) {
+	return a.GetTweakSettingContext(context.Background(), key, module)
+}
+
+func (a WhmApi) GetTweakSettingContext(ctx context.Context, key, module string) (GetTweakSettingApiResponse, error) {
 	var out GetTweakSettingApiResponse
 
-	err := a.WHMAPI1("get_tweaksetting", cpanelgo.Args{
+	err := a.WHMAPI1Context(ctx, "get_tweaksetting", cpanelgo.Args{
 		"key":    key,
 		"module": module,
 	}, &out)
@@ -27,9 +35,13 @@ func (a WhmApi) GetTweakSetting(key, module string) (GetTweakSettingApiResponse,
 }
 
 func (a WhmApi) SetTweakSetting(key, module, value string) (BaseWhmApiResponse, error) {
+	return a.SetTweakSettingContext(context.Background(), key, module, value)
+}
+
+func (a WhmApi) SetTweakSettingContext(ctx context.Context, key, module, value string) (BaseWhmApiResponse, error) {
 	var out BaseWhmApiResponse
 
-	err := a.WHMAPI1("set_tweaksetting", cpanelgo.Args{
+	err := a.WHMAPI1Context(ctx, "set_tweaksetting", cpanelgo.Args{
 		"key":    key,
 		"module": module,
 		"value":  value,
@@ -1,7 +1,7 @@
 package whm
 
 import (
-	"errors"
+	"context"
 
 	"github.com/letsencrypt-cpanel/cpanelgo"
 )
@@ -17,14 +17,18 @@ type CreateUserSessionApiResponse struct {
 }
 
 func (a WhmApi) CreateUserSession(username, service string) (CreateUserSessionApiResponse, error) {
+	return a.CreateUserSessionContext(context.Background(), username, service)
+}
+
+func (a WhmApi) CreateUserSessionContext(ctx context.Context, username, service string) (CreateUserSessionApiResponse, error) {
 	var out CreateUserSessionApiResponse
 
-	err := a.WHMAPI1("create_user_session", cpanelgo.Args{
+	err := a.WHMAPI1Context(ctx, "create_user_session", cpanelgo.Args{
 		"user":    username,
 		"service": service,
 	}, &out)
-	if err == nil && out.Result() != 1 {
-		err = errors.New(out.Metadata.Reason)
+	if err == nil {
+		err = out.Error()
 	}
 
 	return out, err
@@ -1,19 +1,9 @@
 package whm
 
 import (
-	"bytes"
-	"crypto/hmac"
-	"crypto/tls"
-	"encoding/binary"
-	"encoding/json"
-	"errors"
+	"context"
 	"fmt"
-	"hash"
-	"io"
-	"io/ioutil"
-	"log"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
 
@@ -21,17 +11,110 @@ import (
 
 	"time"
 
-	"crypto/sha1"
-	"encoding/base32"
-
 	"github.com/letsencrypt-cpanel/cpanelgo"
 )
 
 type BaseWhmApiResponse struct {
 	Metadata struct {
-		Reason    string      `json:"reason"`
-		ResultRaw interface{} `json:"result"`
+		Reason    string              `json:"reason"`
+		ResultRaw interface{}         `json:"result"`
+		Command   string              `json:"command"`
+		Version   cpanelgo.MaybeInt64 `json:"version"`
+		Output    struct {
+			Warnings cpanelgo.MaybeStrings `json:"warnings"`
+			Messages cpanelgo.MaybeStrings `json:"messages"`
+			Raw      string                `json:"raw"`
+		} `json:"output"`
+		// Set when the results were paginated, see cpanelgo.Query
+		Chunk *Chunk `json:"chunk"`
 	} `json:"metadata"`
+	// a pointer, so that the response types stay comparable
+	info *cpanelgo.ResponseInfo
+}
+
+// Command returns the name of the function which produced the response.
+func (r BaseWhmApiResponse) Command() string {
+	return r.Metadata.Command
+}
+
+// Version returns the version of the API which produced the response.
+func (r BaseWhmApiResponse) Version() int {
+	return int(r.Metadata.Version)
+}
+
+// Messages returns the messages in the output of the function.
+func (r BaseWhmApiResponse) Messages() []string {
+	return r.Metadata.Output.Messages
+}
+
+// AllWarnings returns the warnings in the output of the function, including those
+// reported alongside the response, as BaseUAPIResponse.AllWarnings does.
+func (r BaseWhmApiResponse) AllWarnings() []string {
+	extra := r.ResponseInfo().Warnings
+	if len(extra) == 0 {
+		return r.Metadata.Output.Warnings
+	}
+	return append(append([]string(nil), r.Metadata.Output.Warnings...), extra...)
+}
+
+// HasWarnings reports whether the call raised warnings, whether or not it
+// succeeded.
+func (r BaseWhmApiResponse) HasWarnings() bool {
+	return len(r.Metadata.Output.Warnings) > 0 || len(r.ResponseInfo().Warnings) > 0
+}
+
+// SucceededWithWarnings reports whether the call succeeded but raised warnings,
+// unlike a clean success.
+func (r BaseWhmApiResponse) SucceededWithWarnings() bool {
+	return r.Result() == 1 && r.HasWarnings()
+}
+
+// Chunk describes which chunk of the results a WHM response holds. Chunks are
+// numbered from 1, records from 1.
+type Chunk struct {
+	Start   int `json:"start"`
+	Size    int `json:"size"`
+	Records int `json:"records"`
+	Current int `json:"current"`
+	Chunks  int `json:"chunks"`
+}
+
+// Pagination returns which page of the results the response holds, if the call
+// asked for pagination.
+func (r BaseWhmApiResponse) Pagination() (cpanelgo.Pagination, bool) {
+	c := r.Metadata.Chunk
+	if c == nil {
+		return cpanelgo.Pagination{}, false
+	}
+	p := cpanelgo.Pagination{
+		TotalResults:   c.Records,
+		TotalPages:     c.Chunks,
+		CurrentPage:    c.Current,
+		ResultsPerPage: c.Size,
+		StartResult:    c.Start,
+	}
+	if p.ResultsPerPage > 0 {
+		if p.TotalPages == 0 {
+			p.TotalPages = (p.TotalResults + p.ResultsPerPage - 1) / p.ResultsPerPage
+		}
+		if p.CurrentPage == 0 && p.StartResult > 0 {
+			p.CurrentPage = (p.StartResult-1)/p.ResultsPerPage + 1
+		}
+	}
+	return p, true
+}
+
+func (r *BaseWhmApiResponse) setResponseInfo(info cpanelgo.ResponseInfo) {
+	r.info = &info
+}
+
+// ResponseInfo describes the call which produced the response, it is the zero
+// ResponseInfo if the response was not returned by a gateway.
+func (r BaseWhmApiResponse) ResponseInfo() cpanelgo.ResponseInfo {
+	if r.info == nil {
+		return cpanelgo.ResponseInfo{}
+	}
+	return *r.info
 }
 
 func (r BaseWhmApiResponse) Error() error {
@@ -39,9 +122,24 @@ func (r BaseWhmApiResponse) Error() error {
 		return nil
 	}
 	if len(r.Metadata.Reason) == 0 {
-		return errors.New("Unknown")
+		return r.ResponseInfo().NewAPIError(nil, r.Metadata.Output.Messages, r.Metadata.Output.Warnings)
 	}
-	return errors.New(r.Metadata.Reason)
+	return r.ResponseInfo().NewAPIError([]string{r.Metadata.Reason}, r.Metadata.Output.Messages, r.Metadata.Output.Warnings)
+}
+
+type responseInfoSetter interface {
+	setResponseInfo(info cpanelgo.ResponseInfo)
+}
+
+// SetResponseInfo records the call that produced out, for both WHM responses and
+// the cPanel responses returned through impersonation. See cpanelgo.SetResponseInfo.
+func SetResponseInfo(out interface{}, info cpanelgo.ResponseInfo) {
+	s, ok := out.(responseInfoSetter)
+	if !ok {
+		cpanelgo.SetResponseInfo(out, info)
+		return
+	}
+	s.setResponseInfo(info.Detached())
 }
 
 // WHM randomly returns this as a string, gg
@@ -66,10 +164,30 @@ type WhmApi struct {
 	Hostname   string
 	Username   string
 	AccessHash string
+	// WHM API token, preferred over access hashes which cPanel has deprecated
+	Token      string
 	Password   string
 	Insecure   bool
 	TotpSecret string
-	cl         *http.Client
+	// When set, log in once and reuse the session instead of authenticating every call
+	Session *cpanelgo.Session
+	// When set, calls which are safe to repeat are retried after transient failures.
+	// This is the WHM API 1 counterpart of cpanelgo.RetryingGateway: the typed methods
+	// call WhmApi directly, so only the client itself can retry them.
+	Retry *cpanelgo.RetryPolicy
+	// When set, used instead of https://Hostname:2087. Hostname is its default Host.
+	Endpoint *cpanelgo.Endpoint
+	// Maximum size of a response in bytes, defaults to cpanelgo.ResponseSizeLimit
+	ResponseSizeLimit int64
+	// Decides between GET and POST, defaults to cpanelgo.DefaultMethodPolicy
+	MethodPolicy *cpanelgo.MethodPolicy
+	// Run around every call made through the client
+	Interceptors cpanelgo.Interceptors
+	// Defaults to cpanelgo.DefaultLogger()
+	Logger cpanelgo.Logger
+	// Limits the requests to the server, defaults to cpanelgo.ServerLimiter of its host
+	Limiter *cpanelgo.Limiter
+	cl      *http.Client
 }
 
 func NewWhmApiAccessHash(hostname, username, accessHash string, insecure bool) WhmApi {
@@ -110,105 +228,208 @@ func NewWhmApiAccessHashTotp(hostname, username, accessHash string, insecure boo
 	}
 }
 
-func NewWhmApiPassword(hostname, username, password string, insecure bool) WhmApi {
+func NewWhmApiToken(hostname, username, token string, insecure bool) WhmApi {
 	return WhmApi{
 		Hostname: hostname,
 		Username: username,
-		Password: password,
+		Token:    strings.TrimSpace(token),
 		Insecure: insecure,
 	}
 }
 
-// Force POST method for these WHM API1 functions
-var forcePost = map[string]bool{
-	"cpanel": true,
+func NewWhmApiTokenWithClient(hostname, username, token string, insecure bool, cl *http.Client) WhmApi {
+	return WhmApi{
+		Hostname: hostname,
+		Username: username,
+		Token:    strings.TrimSpace(token),
+		Insecure: insecure,
+		cl:       cl,
+	}
 }
 
-func (c *WhmApi) WHMAPI1(function string, arguments cpanelgo.Args, out interface{}) error {
-	if c.cl == nil {
-		c.cl = &http.Client{}
-		c.cl.Transport = &http.Transport{
-			DisableKeepAlives:   true,
-			MaxIdleConns:        1,
-			MaxIdleConnsPerHost: 1,
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: c.Insecure,
-			},
-		}
+func NewWhmApiTokenTotp(hostname, username, token string, insecure bool, secret string) WhmApi {
+	return WhmApi{
+		Hostname:   hostname,
+		Username:   username,
+		Token:      strings.TrimSpace(token),
+		Insecure:   insecure,
+		TotpSecret: secret,
 	}
+}
 
-	method := "GET"
-	if _, ok := forcePost[function]; ok {
-		method = "POST"
+func NewWhmApiPassword(hostname, username, password string, insecure bool) WhmApi {
+	return WhmApi{
+		Hostname: hostname,
+		Username: username,
+		Password: password,
+		Insecure: insecure,
 	}
+}
 
-	version := "0"
-	if arguments["cpanel_jsonapi_apiversion"] == "1" {
-		version = "1"
+// NewWhmApiSession logs in once and reuses the session for all calls. totpSecret is
+// only needed for accounts with two-factor authentication.
+func NewWhmApiSession(hostname, username, password, totpSecret string, insecure bool) WhmApi {
+	return WhmApi{
+		Hostname: hostname,
+		Username: username,
+		Session:  cpanelgo.NewSession(username, password, totpSecret),
+		Insecure: insecure,
 	}
-	vals := arguments.Values(version)
-	vals.Set("api.version", "1")
+}
 
-	var req *http.Request
-	var reqUrl string
-	var err error
+func (c *WhmApi) WHMAPI1(function string, arguments cpanelgo.Args, out interface{}) error {
+	return c.WHMAPI1Context(context.Background(), function, arguments, out)
+}
 
-	if method == "GET" {
-		reqUrl = fmt.Sprintf("https://%s:2087/json-api/%s?%s", c.Hostname, function, vals.Encode())
-		req, err = http.NewRequest("GET", reqUrl, nil)
-		if err != nil {
-			return err
-		}
+func (c *WhmApi) WHMAPI1Context(ctx context.Context, function string, arguments cpanelgo.Args, out interface{}) error {
+	return c.retry(ctx, "", function, out, func(ctx context.Context, out interface{}) error {
+		return c.Interceptors.Invoke(ctx, &cpanelgo.Call{
+			APIVersion: "whmapi1",
+			Function:   function,
+			Args:       arguments,
+		}, out, c.whmapi1)
+	})
+}
+
+// WHMAPI1Query calls function with the parameters of q added to arguments.
+func (c *WhmApi) WHMAPI1Query(function string, arguments cpanelgo.Args, q cpanelgo.Query, out interface{}) error {
+	return c.WHMAPI1QueryContext(context.Background(), function, arguments, q, out)
+}
 
-	} else if method == "POST" {
-		reqUrl = fmt.Sprintf("https://%s:2087/json-api/%s", c.Hostname, function)
-		req, err = http.NewRequest("POST", reqUrl, strings.NewReader(vals.Encode()))
+func (c *WhmApi) WHMAPI1QueryContext(ctx context.Context, function string, arguments cpanelgo.Args, q cpanelgo.Query, out interface{}) error {
+	return c.WHMAPI1Context(ctx, function, q.Args("whmapi1", arguments), out)
+}
+
+func (c *WhmApi) endpoint() cpanelgo.Endpoint {
+	if c.Endpoint == nil {
+		return cpanelgo.Endpoint{Host: c.Hostname, Port: cpanelgo.WhmPort}
 	}
+	e := *c.Endpoint
+	if e.Host == "" {
+		e.Host = c.Hostname
+	}
+	return e
+}
 
-	if c.AccessHash != "" {
-		req.Header.Add("Authorization", fmt.Sprintf("WHM %s:%s", c.Username, c.AccessHash))
-	} else if c.Password != "" {
-		req.Header.Add("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", c.Username, c.Password))))
+func (c *WhmApi) methodPolicy() cpanelgo.MethodPolicy {
+	if c.MethodPolicy == nil {
+		return cpanelgo.DefaultMethodPolicy
 	}
+	return *c.MethodPolicy
+}
 
-	if c.TotpSecret != "" {
-		decodedSecret, _ := base32.StdEncoding.DecodeString(c.TotpSecret)
-		otp, _ := totp(decodedSecret, time.Now().Unix(), sha1.New, 6)
+func (c *WhmApi) logger() cpanelgo.Logger {
+	if c.Logger == nil {
+		return cpanelgo.DefaultLogger()
+	}
+	return c.Logger
+}
 
-		req.Header.Add("X-CPANEL-OTP", otp)
+// client returns the client given at construction, or else the shared pooled client.
+// It never modifies c, so copies and concurrent callers all use the same connections.
+func (c *WhmApi) client() *http.Client {
+	if c.cl != nil {
+		return c.cl
 	}
+	return cpanelgo.SharedHTTPClient(c.Insecure)
+}
 
-	resp, err := c.cl.Do(req)
-	if err != nil {
-		return err
+func (c *WhmApi) limiter() *cpanelgo.Limiter {
+	if c.Limiter != nil {
+		return c.Limiter
+	}
+	return cpanelgo.ServerLimiter(c.endpoint().Host)
+}
+
+// requester sends the requests of the client, authenticated with the session, API
+// token, access hash or password
+func (c *WhmApi) requester() cpanelgo.Requester {
+	return cpanelgo.Requester{
+		Client:  c.client(),
+		Base:    c.endpoint().URL(),
+		Limiter: c.limiter(),
+		Session: c.Session,
+		Authenticate: func(req *http.Request) error {
+			if c.Token != "" {
+				req.Header.Add("Authorization", fmt.Sprintf("whm %s:%s", c.Username, c.Token))
+			} else if c.AccessHash != "" {
+				req.Header.Add("Authorization", fmt.Sprintf("WHM %s:%s", c.Username, c.AccessHash))
+			} else if c.Password != "" {
+				req.Header.Add("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", c.Username, c.Password))))
+			}
+
+			// sessions were already authenticated with the one-time password at login
+			if c.TotpSecret != "" {
+				otp, err := cpanelgo.TOTP(c.TotpSecret, time.Now())
+				if err != nil {
+					return err
+				}
+				req.Header.Add("X-CPANEL-OTP", otp)
+			}
+			return nil
+		},
+		TokenAuth:         c.Token != "",
+		Name:              "WHM API",
+		Logger:            c.logger(),
+		ResponseSizeLimit: c.ResponseSizeLimit,
 	}
-	defer resp.Body.Close()
+}
+
+// WithClient returns a copy of the client which sends its requests through cl, e.g.
+// one created with cpanelgo.NewHTTPClient
+func (c WhmApi) WithClient(cl *http.Client) WhmApi {
+	c.cl = cl
+	return c
+}
+
+// WithEndpoint returns a copy of the client which connects to endpoint instead of
+// https://Hostname:2087
+func (c WhmApi) WithEndpoint(endpoint cpanelgo.Endpoint) WhmApi {
+	c.Endpoint = &endpoint
+	return c
+}
+
+// WithRetry returns a copy of the client which retries calls according to policy
+func (c WhmApi) WithRetry(policy cpanelgo.RetryPolicy) WhmApi {
+	c.Retry = &policy
+	return c
+}
 
-	if resp.StatusCode >= 300 {
-		return errors.New(resp.Status)
+// WithLimiter returns a copy of the client whose requests are limited by l instead
+// of the limiter of its server
+func (c WhmApi) WithLimiter(l *cpanelgo.Limiter) WhmApi {
+	c.Limiter = l
+	return c
+}
+
+func (c *WhmApi) retry(ctx context.Context, module, function string, out interface{}, fn func(ctx context.Context, out interface{}) error) error {
+	if c.Retry == nil {
+		return fn(ctx, out)
 	}
+	return c.Retry.DoInto(ctx, module, function, out, fn)
+}
 
-	// limit maximum response size
-	lReader := io.LimitReader(resp.Body, int64(cpanelgo.ResponseSizeLimit))
+// whmapi1 performs the call once it has passed through the interceptors
+func (c *WhmApi) whmapi1(ctx context.Context, call *cpanelgo.Call, out interface{}) error {
+	function, arguments := call.Function, call.Args
 
-	bytes, err := ioutil.ReadAll(lReader)
+	params, err := cpanelgo.EncodeArgs(arguments, nil)
 	if err != nil {
 		return err
 	}
+	params = append(cpanelgo.Params{{Name: "api.version", Value: "1"}}, params...)
+	method := c.methodPolicy().Method("", function, params)
 
-	if os.Getenv("DEBUG_CPANEL_RESPONSES") == "1" {
-		log.Println(reqUrl)
-		log.Println(resp.Status)
-		log.Println(function)
-		log.Println(arguments)
-		log.Println(string(bytes))
+	info := cpanelgo.ResponseInfo{
+		APIVersion: "whmapi1",
+		Function:   function,
 	}
-
-	if len(bytes) == cpanelgo.ResponseSizeLimit {
-		return errors.New("API response maximum size exceeded")
+	info, err = c.requester().Call(ctx, call, info, method, "json-api/"+function, params, out)
+	if err != nil {
+		return err
 	}
-
-	return json.Unmarshal(bytes, out)
+	SetResponseInfo(out, info)
+	return nil
 }
 
 type VersionApiResponse struct {
@@ -219,32 +440,14 @@ type VersionApiResponse struct {
 }
 
 func (a WhmApi) Version() (VersionApiResponse, error) {
+	return a.VersionContext(context.Background())
+}
+
+func (a WhmApi) VersionContext(ctx context.Context) (VersionApiResponse, error) {
 	var out VersionApiResponse
-	err := a.WHMAPI1("version", cpanelgo.Args{}, &out)
+	err := a.WHMAPI1Context(ctx, "version", cpanelgo.Args{}, &out)
 	if err == nil && out.Result() != 1 {
 		err = out.Error()
 	}
 	return out, err
 }
-
-func totp(k []byte, t int64, h func() hash.Hash, l int64) (string, error) {
-	if l > 9 || l < 1 {
-		return "", errors.New("Totp: Length out of range.")
-	}
-
-	time := new(bytes.Buffer)
-
-	err := binary.Write(time, binary.BigEndian, (t-int64(0))/int64(30))
-	if err != nil {
-		return "", err
-	}
-
-	hash := hmac.New(h, k)
-	hash.Write(time.Bytes())
-	v := hash.Sum(nil)
-
-	o := v[len(v)-1] & 0xf
-	c := (int32(v[o]&0x7f)<<24 | int32(v[o+1])<<16 | int32(v[o+2])<<8 | int32(v[o+3])) % 1000000000
-
-	return fmt.Sprintf("%010d", c)[10-l : 10], nil
-}
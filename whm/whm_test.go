@@ -0,0 +1,137 @@
+package whm_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/letsencrypt-cpanel/cpanelgo"
+	"github.com/letsencrypt-cpanel/cpanelgo/cpaneltest"
+	"github.com/letsencrypt-cpanel/cpanelgo/whm"
+)
+
+func TestWhmAuthorization(t *testing.T) {
+	const versionBody = `{"metadata":{"result":1,"reason":"OK"},"data":{"version":"11.90.0.5"}}`
+
+	tests := []struct {
+		status   int
+		body     string
+		token    bool
+		header   string
+		expected error
+	}{
+		{http.StatusOK, versionBody, true, "whm root:TOKEN", nil},
+		{http.StatusOK, versionBody, false, "WHM root:HASH", nil},
+		{http.StatusUnauthorized, "Token expired", true, "whm root:TOKEN", cpanelgo.ErrTokenExpired},
+		{http.StatusForbidden, "Access denied", true, "whm root:TOKEN", cpanelgo.ErrTokenRejected},
+	}
+
+	for _, test := range tests {
+		var header string
+		cl := &http.Client{Transport: cpaneltest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+			header = req.Header.Get("Authorization")
+			return cpaneltest.HTTPResponse(test.status, test.body), nil
+		})}
+
+		api := whm.NewWhmApiAccessHashWithClient("example.com", "root", "HA\nSH", false, cl)
+		if test.token {
+			api = whm.NewWhmApiTokenWithClient("example.com", "root", "TOKEN\n", false, cl)
+		}
+
+		out, err := api.Version()
+		if header != test.header {
+			t.Errorf("expected Authorization %q, got: %q", test.header, header)
+		}
+		if test.expected == nil {
+			if err != nil || out.Data.Version != "11.90.0.5" {
+				t.Errorf("unexpected result: %+v, %v", out, err)
+			}
+		} else if !errors.Is(err, test.expected) {
+			t.Errorf("expected %v, got: %v", test.expected, err)
+		}
+	}
+}
+
+func TestWhmEndpoint(t *testing.T) {
+	var url string
+	cl := &http.Client{Transport: cpaneltest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		url = req.URL.Scheme + "://" + req.URL.Host + req.URL.Path
+		return cpaneltest.HTTPResponse(http.StatusOK, `{"metadata":{"result":1},"data":{"version":"11.90.0.5"}}`), nil
+	})}
+
+	api := whm.NewWhmApiTokenWithClient("::1", "root", "TOKEN", false, cl)
+	if _, err := api.Version(); err != nil || url != "https://[::1]:2087/json-api/version" {
+		t.Errorf("unexpected request to %s: %v", url, err)
+	}
+
+	api = api.WithEndpoint(cpanelgo.Endpoint{Host: "whm.example.com", PathPrefix: "/proxy"})
+	if _, err := api.Version(); err != nil || url != "https://whm.example.com/proxy/json-api/version" {
+		t.Errorf("unexpected request to %s: %v", url, err)
+	}
+
+	api = api.WithEndpoint(cpanelgo.Endpoint{Port: 2086, Scheme: "http"})
+	if _, err := api.Version(); err != nil || url != "http://[::1]:2086/json-api/version" {
+		t.Errorf("unexpected request to %s: %v", url, err)
+	}
+}
+
+func TestWhmTotp(t *testing.T) {
+	var otp string
+	requests := 0
+	cl := &http.Client{Transport: cpaneltest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requests++
+		otp = req.Header.Get("X-CPANEL-OTP")
+		return cpaneltest.HTTPResponse(http.StatusOK, `{"metadata":{"result":1},"data":{"version":"11.90.0.5"}}`), nil
+	})}
+
+	api := whm.NewWhmApiTokenWithClient("example.com", "root", "TOKEN", false, cl)
+	api.TotpSecret = "JBSWY3DPEHPK3PXP"
+	if _, err := api.Version(); err != nil || len(otp) != 6 {
+		t.Errorf("unexpected one-time password %q: %v", otp, err)
+	}
+
+	api.TotpSecret = "not base32!"
+	if _, err := api.Version(); err == nil || requests != 1 {
+		t.Errorf("expected an error without a request, got %d requests: %v", requests, err)
+	}
+}
+
+func TestWhmResponseSizeLimit(t *testing.T) {
+	cl := &http.Client{Transport: cpaneltest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return cpaneltest.HTTPResponse(http.StatusOK, `{"metadata":{"result":1},"data":{"acct":[`+strings.Repeat(`{"user":"bob"},`, 100)+`{}]}}`), nil
+	})}
+
+	api := whm.NewWhmApiTokenWithClient("example.com", "root", "TOKEN", false, cl)
+	api.ResponseSizeLimit = 1024
+	_, err := api.ListAccounts()
+	var tooLarge *cpanelgo.ResponseTooLargeError
+	if !errors.As(err, &tooLarge) || tooLarge.Limit != 1024 {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestBaseWhmApiResponseMetadata(t *testing.T) {
+	var out whm.BaseWhmApiResponse
+	body := `{"metadata":{"result":1,"reason":"OK","command":"installssl","version":1,"output":{"warnings":"The certificate does not cover www.example.com.","raw":"done"}}}`
+	if err := json.Unmarshal([]byte(body), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Command() != "installssl" || out.Version() != 1 || out.Metadata.Output.Raw != "done" {
+		t.Errorf("unexpected metadata: %+v", out.Metadata)
+	}
+	if out.Error() != nil || !out.SucceededWithWarnings() || len(out.AllWarnings()) != 1 {
+		t.Errorf("expected success with warnings: %+v", out)
+	}
+
+	var failed whm.BaseWhmApiResponse
+	body = `{"metadata":{"result":0,"reason":"Failed","command":"installssl","version":"1","output":{"warnings":["w1","w2"],"messages":["m"]}}}`
+	if err := json.Unmarshal([]byte(body), &failed); err != nil {
+		t.Fatal(err)
+	}
+	var apiErr *cpanelgo.APIError
+	if err := failed.Error(); !errors.As(err, &apiErr) || len(apiErr.Warnings) != 2 || len(apiErr.Messages) != 1 || failed.SucceededWithWarnings() {
+		t.Errorf("unexpected error: %+v", err)
+	}
+}